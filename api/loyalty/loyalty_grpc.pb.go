@@ -0,0 +1,398 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: api/loyalty/loyalty.proto
+
+package loyalty
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	LoyaltyService_Register_FullMethodName        = "/loyalty.v1.LoyaltyService/Register"
+	LoyaltyService_Login_FullMethodName           = "/loyalty.v1.LoyaltyService/Login"
+	LoyaltyService_UploadOrder_FullMethodName     = "/loyalty.v1.LoyaltyService/UploadOrder"
+	LoyaltyService_ListOrders_FullMethodName      = "/loyalty.v1.LoyaltyService/ListOrders"
+	LoyaltyService_GetBalance_FullMethodName      = "/loyalty.v1.LoyaltyService/GetBalance"
+	LoyaltyService_Withdraw_FullMethodName        = "/loyalty.v1.LoyaltyService/Withdraw"
+	LoyaltyService_ListWithdrawals_FullMethodName = "/loyalty.v1.LoyaltyService/ListWithdrawals"
+	LoyaltyService_WatchOrders_FullMethodName     = "/loyalty.v1.LoyaltyService/WatchOrders"
+)
+
+// LoyaltyServiceClient is the client API for LoyaltyService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LoyaltyServiceClient interface {
+	Register(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Token, error)
+	Login(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Token, error)
+	UploadOrder(ctx context.Context, in *UploadOrderRequest, opts ...grpc.CallOption) (*UploadOrderResponse, error)
+	ListOrders(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListOrdersResponse, error)
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*Balance, error)
+	Withdraw(ctx context.Context, in *WithdrawRequest, opts ...grpc.CallOption) (*WithdrawResponse, error)
+	ListWithdrawals(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListWithdrawalsResponse, error)
+	// WatchOrders streams order status changes, resuming after last_event_id.
+	WatchOrders(ctx context.Context, in *WatchOrdersRequest, opts ...grpc.CallOption) (LoyaltyService_WatchOrdersClient, error)
+}
+
+type loyaltyServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLoyaltyServiceClient(cc grpc.ClientConnInterface) LoyaltyServiceClient {
+	return &loyaltyServiceClient{cc}
+}
+
+func (c *loyaltyServiceClient) Register(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, LoyaltyService_Register_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loyaltyServiceClient) Login(ctx context.Context, in *Credentials, opts ...grpc.CallOption) (*Token, error) {
+	out := new(Token)
+	err := c.cc.Invoke(ctx, LoyaltyService_Login_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loyaltyServiceClient) UploadOrder(ctx context.Context, in *UploadOrderRequest, opts ...grpc.CallOption) (*UploadOrderResponse, error) {
+	out := new(UploadOrderResponse)
+	err := c.cc.Invoke(ctx, LoyaltyService_UploadOrder_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loyaltyServiceClient) ListOrders(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListOrdersResponse, error) {
+	out := new(ListOrdersResponse)
+	err := c.cc.Invoke(ctx, LoyaltyService_ListOrders_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loyaltyServiceClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*Balance, error) {
+	out := new(Balance)
+	err := c.cc.Invoke(ctx, LoyaltyService_GetBalance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loyaltyServiceClient) Withdraw(ctx context.Context, in *WithdrawRequest, opts ...grpc.CallOption) (*WithdrawResponse, error) {
+	out := new(WithdrawResponse)
+	err := c.cc.Invoke(ctx, LoyaltyService_Withdraw_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loyaltyServiceClient) ListWithdrawals(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListWithdrawalsResponse, error) {
+	out := new(ListWithdrawalsResponse)
+	err := c.cc.Invoke(ctx, LoyaltyService_ListWithdrawals_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *loyaltyServiceClient) WatchOrders(ctx context.Context, in *WatchOrdersRequest, opts ...grpc.CallOption) (LoyaltyService_WatchOrdersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LoyaltyService_ServiceDesc.Streams[0], LoyaltyService_WatchOrders_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &loyaltyServiceWatchOrdersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LoyaltyService_WatchOrdersClient interface {
+	Recv() (*OrderEvent, error)
+	grpc.ClientStream
+}
+
+type loyaltyServiceWatchOrdersClient struct {
+	grpc.ClientStream
+}
+
+func (x *loyaltyServiceWatchOrdersClient) Recv() (*OrderEvent, error) {
+	m := new(OrderEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoyaltyServiceServer is the server API for LoyaltyService service.
+// All implementations must embed UnimplementedLoyaltyServiceServer
+// for forward compatibility
+type LoyaltyServiceServer interface {
+	Register(context.Context, *Credentials) (*Token, error)
+	Login(context.Context, *Credentials) (*Token, error)
+	UploadOrder(context.Context, *UploadOrderRequest) (*UploadOrderResponse, error)
+	ListOrders(context.Context, *ListRequest) (*ListOrdersResponse, error)
+	GetBalance(context.Context, *GetBalanceRequest) (*Balance, error)
+	Withdraw(context.Context, *WithdrawRequest) (*WithdrawResponse, error)
+	ListWithdrawals(context.Context, *ListRequest) (*ListWithdrawalsResponse, error)
+	// WatchOrders streams order status changes, resuming after last_event_id.
+	WatchOrders(*WatchOrdersRequest, LoyaltyService_WatchOrdersServer) error
+	mustEmbedUnimplementedLoyaltyServiceServer()
+}
+
+// UnimplementedLoyaltyServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedLoyaltyServiceServer struct {
+}
+
+func (UnimplementedLoyaltyServiceServer) Register(context.Context, *Credentials) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) Login(context.Context, *Credentials) (*Token, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) UploadOrder(context.Context, *UploadOrderRequest) (*UploadOrderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UploadOrder not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) ListOrders(context.Context, *ListRequest) (*ListOrdersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListOrders not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) GetBalance(context.Context, *GetBalanceRequest) (*Balance, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) Withdraw(context.Context, *WithdrawRequest) (*WithdrawResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Withdraw not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) ListWithdrawals(context.Context, *ListRequest) (*ListWithdrawalsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListWithdrawals not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) WatchOrders(*WatchOrdersRequest, LoyaltyService_WatchOrdersServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchOrders not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) mustEmbedUnimplementedLoyaltyServiceServer() {}
+
+// UnsafeLoyaltyServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LoyaltyServiceServer will
+// result in compilation errors.
+type UnsafeLoyaltyServiceServer interface {
+	mustEmbedUnimplementedLoyaltyServiceServer()
+}
+
+func RegisterLoyaltyServiceServer(s grpc.ServiceRegistrar, srv LoyaltyServiceServer) {
+	s.RegisterService(&LoyaltyService_ServiceDesc, srv)
+}
+
+func _LoyaltyService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Credentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoyaltyServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoyaltyService_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoyaltyServiceServer).Register(ctx, req.(*Credentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoyaltyService_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Credentials)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoyaltyServiceServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoyaltyService_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoyaltyServiceServer).Login(ctx, req.(*Credentials))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoyaltyService_UploadOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoyaltyServiceServer).UploadOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoyaltyService_UploadOrder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoyaltyServiceServer).UploadOrder(ctx, req.(*UploadOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoyaltyService_ListOrders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoyaltyServiceServer).ListOrders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoyaltyService_ListOrders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoyaltyServiceServer).ListOrders(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoyaltyService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoyaltyServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoyaltyService_GetBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoyaltyServiceServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoyaltyService_Withdraw_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WithdrawRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoyaltyServiceServer).Withdraw(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoyaltyService_Withdraw_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoyaltyServiceServer).Withdraw(ctx, req.(*WithdrawRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoyaltyService_ListWithdrawals_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoyaltyServiceServer).ListWithdrawals(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoyaltyService_ListWithdrawals_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoyaltyServiceServer).ListWithdrawals(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LoyaltyService_WatchOrders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchOrdersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LoyaltyServiceServer).WatchOrders(m, &loyaltyServiceWatchOrdersServer{stream})
+}
+
+type LoyaltyService_WatchOrdersServer interface {
+	Send(*OrderEvent) error
+	grpc.ServerStream
+}
+
+type loyaltyServiceWatchOrdersServer struct {
+	grpc.ServerStream
+}
+
+func (x *loyaltyServiceWatchOrdersServer) Send(m *OrderEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// LoyaltyService_ServiceDesc is the grpc.ServiceDesc for LoyaltyService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LoyaltyService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "loyalty.v1.LoyaltyService",
+	HandlerType: (*LoyaltyServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _LoyaltyService_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _LoyaltyService_Login_Handler,
+		},
+		{
+			MethodName: "UploadOrder",
+			Handler:    _LoyaltyService_UploadOrder_Handler,
+		},
+		{
+			MethodName: "ListOrders",
+			Handler:    _LoyaltyService_ListOrders_Handler,
+		},
+		{
+			MethodName: "GetBalance",
+			Handler:    _LoyaltyService_GetBalance_Handler,
+		},
+		{
+			MethodName: "Withdraw",
+			Handler:    _LoyaltyService_Withdraw_Handler,
+		},
+		{
+			MethodName: "ListWithdrawals",
+			Handler:    _LoyaltyService_ListWithdrawals_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchOrders",
+			Handler:       _LoyaltyService_WatchOrders_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/loyalty/loyalty.proto",
+}
@@ -0,0 +1,203 @@
+// Package openapi embeds the OpenAPI 3 documents of the user API versions and
+// checks requests and routes against them.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+var (
+	//go:embed openapi.json
+	Spec []byte
+	//go:embed openapi_v2.json
+	SpecV2 []byte
+)
+
+type Document struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+
+	patterns map[string]*regexp.Regexp
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema the document uses.
+type Schema struct {
+	Ref              string             `json:"$ref"`
+	Type             string             `json:"type"`
+	Required         []string           `json:"required"`
+	Properties       map[string]*Schema `json:"properties"`
+	Items            *Schema            `json:"items"`
+	OneOf            []*Schema          `json:"oneOf"`
+	Enum             []any              `json:"enum"`
+	Pattern          string             `json:"pattern"`
+	MinLength        *int               `json:"minLength"`
+	Minimum          *float64           `json:"minimum"`
+	ExclusiveMinimum bool               `json:"exclusiveMinimum"`
+}
+
+// Load parses one of the embedded documents and compiles its patterns.
+func Load(spec []byte) (*Document, error) {
+
+	doc := &Document{}
+	err := json.Unmarshal(spec, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.patterns = make(map[string]*regexp.Regexp)
+	for _, s := range doc.Components.Schemas {
+		if err = doc.compile(s); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range doc.Paths {
+		for _, op := range item {
+			if op.RequestBody == nil {
+				continue
+			}
+			for _, content := range op.RequestBody.Content {
+				if err = doc.compile(content.Schema); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+func (d *Document) compile(s *Schema) error {
+
+	if s == nil {
+		return nil
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		d.patterns[s.Pattern] = re
+	}
+
+	for _, prop := range s.Properties {
+		if err := d.compile(prop); err != nil {
+			return err
+		}
+	}
+	for _, alt := range s.OneOf {
+		if err := d.compile(alt); err != nil {
+			return err
+		}
+	}
+
+	return d.compile(s.Items)
+}
+
+// Operation finds the operation for the request path. Path templates like
+// /items/{id} match any single segment.
+func (d *Document) Operation(method, path string) (*Operation, bool) {
+
+	for tmpl, item := range d.Paths {
+		if !match(tmpl, path) {
+			continue
+		}
+		op, ok := item[strings.ToLower(method)]
+		return op, ok
+	}
+
+	return nil, false
+}
+
+func match(tmpl, path string) bool {
+
+	t := strings.Split(strings.Trim(tmpl, "/"), "/")
+	p := strings.Split(strings.Trim(path, "/"), "/")
+	if len(t) != len(p) {
+		return false
+	}
+
+	for i := range t {
+		if strings.HasPrefix(t[i], "{") && strings.HasSuffix(t[i], "}") {
+			continue
+		}
+		if t[i] != p[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+var methods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true, "patch": true, "head": true, "options": true,
+}
+
+// Drift lists the differences between the routes mounted at mount and the
+// document paths under base. An empty result means they agree.
+func (d *Document) Drift(routes chi.Routes, mount, base string) ([]string, error) {
+
+	prefix := base + "/"
+	routed := make(map[string]bool)
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/*")
+		if strings.HasPrefix(route, mount+"/") {
+			routed[strings.ToLower(method)+" "+base+strings.TrimPrefix(route, mount)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range d.Paths {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		for method := range item {
+			if methods[method] {
+				documented[method+" "+strings.TrimSuffix(path, "/")] = true
+			}
+		}
+	}
+
+	drift := make([]string, 0)
+	for op := range routed {
+		if !documented[op] {
+			drift = append(drift, fmt.Sprintf("%s is routed but not documented", op))
+		}
+	}
+	for op := range documented {
+		if !routed[op] {
+			drift = append(drift, fmt.Sprintf("%s is documented but not routed", op))
+		}
+	}
+	sort.Strings(drift)
+
+	return drift, nil
+}
@@ -0,0 +1,165 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Violation is one place where a value doesn't fit its schema.
+type Violation struct {
+	Field  string
+	Reason string
+}
+
+// Validate checks a decoded JSON value against the schema. Numbers must be
+// decoded as json.Number.
+func (d *Document) Validate(v any, s *Schema) []Violation {
+	return d.validate(v, s, "")
+}
+
+func (d *Document) resolve(s *Schema) *Schema {
+
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+
+	return s
+}
+
+func (d *Document) validate(v any, s *Schema, field string) []Violation {
+
+	s = d.resolve(s)
+	if s == nil {
+		return nil
+	}
+
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, alt := range s.OneOf {
+			if len(d.validate(v, alt, field)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return []Violation{{Field: name(field), Reason: "doesn't match exactly one of the allowed forms"}}
+		}
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return []Violation{{Field: name(field), Reason: "must be an object"}}
+		}
+		list := make([]Violation, 0)
+		for _, key := range s.Required {
+			if _, ok := obj[key]; !ok {
+				list = append(list, Violation{Field: join(field, key), Reason: "is required"})
+			}
+		}
+		keys := make([]string, 0, len(s.Properties))
+		for key := range s.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if value, ok := obj[key]; ok {
+				list = append(list, d.validate(value, s.Properties[key], join(field, key))...)
+			}
+		}
+		return list
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return []Violation{{Field: name(field), Reason: "must be an array"}}
+		}
+		list := make([]Violation, 0)
+		for i, item := range items {
+			list = append(list, d.validate(item, s.Items, fmt.Sprintf("%s[%d]", field, i))...)
+		}
+		return list
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []Violation{{Field: name(field), Reason: "must be a string"}}
+		}
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			if *s.MinLength == 1 {
+				return []Violation{{Field: name(field), Reason: "is required"}}
+			}
+			return []Violation{{Field: name(field), Reason: fmt.Sprintf("must be at least %d characters", *s.MinLength)}}
+		}
+		if re := d.patterns[s.Pattern]; re != nil && !re.MatchString(str) {
+			return []Violation{{Field: name(field), Reason: "must match " + s.Pattern}}
+		}
+		return d.enum(str, s, field)
+	case "number", "integer":
+		num, ok := v.(json.Number)
+		if !ok {
+			return []Violation{{Field: name(field), Reason: "must be a number"}}
+		}
+		if s.Type == "integer" {
+			if _, err := num.Int64(); err != nil {
+				return []Violation{{Field: name(field), Reason: "must be an integer"}}
+			}
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return []Violation{{Field: name(field), Reason: "must be a number"}}
+		}
+		if s.Minimum != nil {
+			if s.ExclusiveMinimum && f <= *s.Minimum {
+				return []Violation{{Field: name(field), Reason: fmt.Sprintf("must be greater than %g", *s.Minimum)}}
+			}
+			if f < *s.Minimum {
+				return []Violation{{Field: name(field), Reason: fmt.Sprintf("must be at least %g", *s.Minimum)}}
+			}
+		}
+		return nil
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []Violation{{Field: name(field), Reason: "must be a boolean"}}
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) enum(v string, s *Schema, field string) []Violation {
+
+	if len(s.Enum) < 1 {
+		return nil
+	}
+
+	allowed := make([]string, 0, len(s.Enum))
+	for _, e := range s.Enum {
+		if e == v {
+			return nil
+		}
+		allowed = append(allowed, fmt.Sprint(e))
+	}
+
+	return []Violation{{Field: name(field), Reason: "must be one of " + strings.Join(allowed, ", ")}}
+}
+
+func join(field, key string) string {
+
+	if field == "" {
+		return key
+	}
+
+	return field + "." + key
+}
+
+// name makes the root of the body addressable.
+func name(field string) string {
+
+	if field == "" {
+		return "body"
+	}
+
+	return field
+}
@@ -1,31 +1,234 @@
+// Package config loads the service configuration. Every setting can come from
+// a YAML or TOML file, the environment and the command line; later sources win:
+//
+//	defaults < config file (-config, CONFIG_FILE) < environment < flags
+//
+// A flag only overrides the other sources when it is given explicitly.
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env"
 )
 
 type Config struct {
-	RunAddress           string `env:"RUN_ADDRESS" envDefault:"127.0.0.1:8081"`
-	DatabaseURI          string `env:"DATABASE_URI"`
-	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://127.0.0.1:8080"`
-	JWTSecretKey         string `env:"JWT_SECRET_KEY" envDefault:"Secret-Key!"`
+	RunAddress            string        `env:"RUN_ADDRESS" yaml:"run_address" toml:"run_address"`
+	GRPCAddress           string        `env:"GRPC_ADDRESS" yaml:"grpc_address" toml:"grpc_address"`
+	TLSCertFile           string        `env:"TLS_CERT_FILE" yaml:"tls_cert_file" toml:"tls_cert_file"`
+	TLSKeyFile            string        `env:"TLS_KEY_FILE" yaml:"tls_key_file" toml:"tls_key_file"`
+	TLSClientCAFile       string        `env:"TLS_CLIENT_CA_FILE" yaml:"tls_client_ca_file" toml:"tls_client_ca_file"`
+	ReadHeaderTimeout     time.Duration `env:"READ_HEADER_TIMEOUT" yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout           time.Duration `env:"READ_TIMEOUT" yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout          time.Duration `env:"WRITE_TIMEOUT" yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout           time.Duration `env:"IDLE_TIMEOUT" yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxBodyBytes          int64         `env:"MAX_BODY_BYTES" yaml:"max_body_bytes" toml:"max_body_bytes"`
+	BatchMaxBodyBytes     int64         `env:"BATCH_MAX_BODY_BYTES" yaml:"batch_max_body_bytes" toml:"batch_max_body_bytes"`
+	MaxDecompressedBytes  int64         `env:"MAX_DECOMPRESSED_BYTES" yaml:"max_decompressed_bytes" toml:"max_decompressed_bytes"`
+	CompressMinSize       int           `env:"COMPRESS_MIN_SIZE" yaml:"compress_min_size" toml:"compress_min_size"`
+	CompressTypes         string        `env:"COMPRESS_TYPES" yaml:"compress_types" toml:"compress_types"`
+	RateLimitStore        string        `env:"RATE_LIMIT_STORE" yaml:"rate_limit_store" toml:"rate_limit_store"`
+	RateLimitIP           string        `env:"RATE_LIMIT_IP" yaml:"rate_limit_ip" toml:"rate_limit_ip"`
+	RateLimitUser         string        `env:"RATE_LIMIT_USER" yaml:"rate_limit_user" toml:"rate_limit_user"`
+	RateLimitAuth         string        `env:"RATE_LIMIT_AUTH" yaml:"rate_limit_auth" toml:"rate_limit_auth"`
+	RateLimitOrders       string        `env:"RATE_LIMIT_ORDERS" yaml:"rate_limit_orders" toml:"rate_limit_orders"`
+	ClientIPHeader        string        `env:"CLIENT_IP_HEADER" yaml:"client_ip_header" toml:"client_ip_header"`
+	MetricsAddress        string        `env:"METRICS_ADDRESS" yaml:"metrics_address" toml:"metrics_address"`
+	TraceExporter         string        `env:"TRACE_EXPORTER" yaml:"trace_exporter" toml:"trace_exporter"`
+	TraceFile             string        `env:"TRACE_FILE" yaml:"trace_file" toml:"trace_file"`
+	TraceSampleRatio      float64       `env:"TRACE_SAMPLE_RATIO" yaml:"trace_sample_ratio" toml:"trace_sample_ratio"`
+	OTLPEndpoint          string        `env:"OTLP_ENDPOINT" yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	OTLPInsecure          bool          `env:"OTLP_INSECURE" yaml:"otlp_insecure" toml:"otlp_insecure"`
+	LogFormat             string        `env:"LOG_FORMAT" yaml:"log_format" toml:"log_format"`
+	LogLevel              string        `env:"LOG_LEVEL" yaml:"log_level" toml:"log_level"`
+	LogFile               string        `env:"LOG_FILE" yaml:"log_file" toml:"log_file"`
+	LogMaxSizeMB          int           `env:"LOG_MAX_SIZE_MB" yaml:"log_max_size_mb" toml:"log_max_size_mb"`
+	LogMaxBackups         int           `env:"LOG_MAX_BACKUPS" yaml:"log_max_backups" toml:"log_max_backups"`
+	LogMaxAgeDays         int           `env:"LOG_MAX_AGE_DAYS" yaml:"log_max_age_days" toml:"log_max_age_days"`
+	DatabaseURI           string        `env:"DATABASE_URI" yaml:"database_uri" toml:"database_uri"`
+	Storage               string        `env:"STORAGE" yaml:"storage" toml:"storage"`
+	AccrualSystemAddress  string        `env:"ACCRUAL_SYSTEM_ADDRESS" yaml:"accrual_system_address" toml:"accrual_system_address"`
+	AccrualTimeout        time.Duration `env:"ACCRUAL_TIMEOUT" yaml:"accrual_timeout" toml:"accrual_timeout"`
+	JWTSecretKey          string        `env:"JWT_SECRET_KEY" yaml:"jwt_secret_key" toml:"jwt_secret_key"`
+	TokenTTL              time.Duration `env:"TOKEN_TTL" yaml:"token_ttl" toml:"token_ttl"`
+	AdminToken            string        `env:"ADMIN_TOKEN" yaml:"admin_token" toml:"admin_token"`
+	TransferDailyLimit    float64       `env:"TRANSFER_DAILY_LIMIT" yaml:"transfer_daily_limit" toml:"transfer_daily_limit"`
+	BatchMaxSize          int           `env:"ORDERS_BATCH_MAX_SIZE" yaml:"orders_batch_max_size" toml:"orders_batch_max_size"`
+	OrderValidators       string        `env:"ORDER_VALIDATORS" yaml:"order_validators" toml:"order_validators"`
+	WebhookMaxAttempts    int           `env:"WEBHOOK_MAX_ATTEMPTS" yaml:"webhook_max_attempts" toml:"webhook_max_attempts"`
+	AccrualCallbackSecret string        `env:"ACCRUAL_CALLBACK_SECRET" yaml:"accrual_callback_secret" toml:"accrual_callback_secret"`
+	ScanInterval          time.Duration `env:"SCAN_INTERVAL" yaml:"scan_interval" toml:"scan_interval"`
+	ScanWorkers           int           `env:"SCAN_WORKERS" yaml:"scan_workers" toml:"scan_workers"`
+	ReconcileInterval     time.Duration `env:"RECONCILE_INTERVAL" yaml:"reconcile_interval" toml:"reconcile_interval"`
+	SwaggerUI             bool          `env:"SWAGGER_UI" yaml:"swagger_ui" toml:"swagger_ui"`
+	SwaggerUIAssets       string        `env:"SWAGGER_UI_ASSETS" yaml:"swagger_ui_assets" toml:"swagger_ui_assets"`
+	V1Sunset              string        `env:"API_V1_SUNSET" yaml:"api_v1_sunset" toml:"api_v1_sunset"`
+	ShutdownDelay         time.Duration `env:"SHUTDOWN_DELAY" yaml:"shutdown_delay" toml:"shutdown_delay"`
+	ShutdownTimeout       time.Duration `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
 }
 
-func GetConfig() (*Config, error) {
+// Default is the configuration used when no source sets a value.
+func Default() Config {
+	return Config{
+		RunAddress:           "127.0.0.1:8081",
+		ReadHeaderTimeout:    time.Second * 5,
+		ReadTimeout:          time.Second * 30,
+		WriteTimeout:         time.Minute,
+		IdleTimeout:          time.Minute * 2,
+		MaxBodyBytes:         1 << 20,
+		BatchMaxBodyBytes:    8 << 20,
+		MaxDecompressedBytes: 8 << 20,
+		CompressMinSize:      1024,
+		CompressTypes:        "application/json,application/problem+json,text/*",
+		RateLimitStore:       "memory",
+		RateLimitIP:          "300/1m",
+		RateLimitUser:        "120/1m",
+		RateLimitAuth:        "10/1m",
+		RateLimitOrders:      "30/1m",
+		TraceExporter:        "none",
+		TraceFile:            "traces.json",
+		TraceSampleRatio:     1,
+		LogFormat:            "text",
+		LogLevel:             "info",
+		LogFile:              "logs/all.log",
+		LogMaxSizeMB:         100,
+		LogMaxBackups:        5,
+		LogMaxAgeDays:        28,
+		Storage:              "postgres",
+		AccrualSystemAddress: "http://127.0.0.1:8080",
+		AccrualTimeout:       time.Second * 10,
+		JWTSecretKey:         "Secret-Key!",
+		TokenTTL:             time.Hour * 24,
+		TransferDailyLimit:   1000,
+		BatchMaxSize:         1000,
+		WebhookMaxAttempts:   10,
+		ScanInterval:         time.Millisecond * 100,
+		ScanWorkers:          1,
+		ReconcileInterval:    time.Minute,
+		SwaggerUIAssets:      "https://unpkg.com/swagger-ui-dist@5.17.14",
+		V1Sunset:             "2027-04-19",
+		ShutdownDelay:        time.Second * 5,
+		ShutdownTimeout:      time.Second * 10,
+	}
+}
 
-	cfg := &Config{}
-	flag.StringVar(&cfg.RunAddress, "a", "127.0.0.1:8081", "RUN_ADDRESS")
-	flag.StringVar(&cfg.DatabaseURI, "d", "", "DATABASE_URI")
-	flag.StringVar(&cfg.AccrualSystemAddress, "r", "", "ACCRUAL_SYSTEM_ADDRESS")
-	flag.StringVar(&cfg.JWTSecretKey, "j", "", "JWT_SECRET_KEY")
+// bind defines the flags of c with its current values as defaults.
+func bind(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.RunAddress, "a", c.RunAddress, "RUN_ADDRESS")
+	fs.StringVar(&c.GRPCAddress, "g", c.GRPCAddress, "GRPC_ADDRESS")
+	fs.StringVar(&c.TLSCertFile, "tls-cert", c.TLSCertFile, "TLS_CERT_FILE: certificate of the HTTP and gRPC APIs, reloaded when the file changes")
+	fs.StringVar(&c.TLSKeyFile, "tls-key", c.TLSKeyFile, "TLS_KEY_FILE: private key of the API certificate")
+	fs.StringVar(&c.TLSClientCAFile, "tls-client-ca", c.TLSClientCAFile, "TLS_CLIENT_CA_FILE: CA of the client certificates the accrual system may call back with")
+	fs.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", c.ReadHeaderTimeout, "READ_HEADER_TIMEOUT: time to read the request headers")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "READ_TIMEOUT: time to read the whole request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "WRITE_TIMEOUT: time to write the response, or each message of an event stream")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "IDLE_TIMEOUT: how long an idle keep-alive connection is kept")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body", c.MaxBodyBytes, "MAX_BODY_BYTES: request body limit")
+	fs.Int64Var(&c.BatchMaxBodyBytes, "batch-max-body", c.BatchMaxBodyBytes, "BATCH_MAX_BODY_BYTES: request body limit of order batches")
+	fs.Int64Var(&c.MaxDecompressedBytes, "max-decompressed", c.MaxDecompressedBytes, "MAX_DECOMPRESSED_BYTES: limit of a compressed request body once decompressed")
+	fs.IntVar(&c.CompressMinSize, "compress-min-size", c.CompressMinSize, "COMPRESS_MIN_SIZE: responses shorter than this are not compressed")
+	fs.StringVar(&c.CompressTypes, "compress-types", c.CompressTypes, "COMPRESS_TYPES: comma-separated content types to compress, like text/*")
+	fs.StringVar(&c.RateLimitStore, "rate-limit-store", c.RateLimitStore, "RATE_LIMIT_STORE: memory, or postgres to share the limits between replicas")
+	fs.StringVar(&c.RateLimitIP, "rate-limit-ip", c.RateLimitIP, "RATE_LIMIT_IP: requests per client IP to the user API, like 300/1m; empty for no limit")
+	fs.StringVar(&c.RateLimitUser, "rate-limit-user", c.RateLimitUser, "RATE_LIMIT_USER: requests per user to the user API")
+	fs.StringVar(&c.RateLimitAuth, "rate-limit-auth", c.RateLimitAuth, "RATE_LIMIT_AUTH: logins and registrations per client IP")
+	fs.StringVar(&c.RateLimitOrders, "rate-limit-orders", c.RateLimitOrders, "RATE_LIMIT_ORDERS: order uploads per user")
+	fs.StringVar(&c.ClientIPHeader, "client-ip-header", c.ClientIPHeader, "CLIENT_IP_HEADER: header a trusted proxy puts the client IP in, like X-Forwarded-For")
+	fs.StringVar(&c.MetricsAddress, "m", c.MetricsAddress, "METRICS_ADDRESS: admin listener serving /metrics")
+	fs.StringVar(&c.TraceExporter, "trace-exporter", c.TraceExporter, "TRACE_EXPORTER: none, otlp, stdout or file")
+	fs.StringVar(&c.TraceFile, "trace-file", c.TraceFile, "TRACE_FILE: file of the file trace exporter")
+	fs.Float64Var(&c.TraceSampleRatio, "trace-sample", c.TraceSampleRatio, "TRACE_SAMPLE_RATIO: share of traces sampled, from 0 to 1")
+	fs.StringVar(&c.OTLPEndpoint, "otlp-endpoint", c.OTLPEndpoint, "OTLP_ENDPOINT: host:port of the OTLP gRPC collector")
+	fs.BoolVar(&c.OTLPInsecure, "otlp-insecure", c.OTLPInsecure, "OTLP_INSECURE: export without TLS")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "LOG_FORMAT: text or json")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "LOG_LEVEL: trace, debug, info, warn or error")
+	fs.StringVar(&c.LogFile, "log-file", c.LogFile, "LOG_FILE: rotated log file, empty for stdout only")
+	fs.IntVar(&c.LogMaxSizeMB, "log-max-size", c.LogMaxSizeMB, "LOG_MAX_SIZE_MB: size of the log file that triggers rotation")
+	fs.IntVar(&c.LogMaxBackups, "log-max-backups", c.LogMaxBackups, "LOG_MAX_BACKUPS: rotated log files kept")
+	fs.IntVar(&c.LogMaxAgeDays, "log-max-age", c.LogMaxAgeDays, "LOG_MAX_AGE_DAYS: days rotated log files are kept")
+	fs.StringVar(&c.DatabaseURI, "d", c.DatabaseURI, "DATABASE_URI")
+	fs.StringVar(&c.Storage, "storage", c.Storage, "STORAGE: postgres or memory")
+	fs.StringVar(&c.AccrualSystemAddress, "r", c.AccrualSystemAddress, "ACCRUAL_SYSTEM_ADDRESS")
+	fs.DurationVar(&c.AccrualTimeout, "accrual-timeout", c.AccrualTimeout, "ACCRUAL_TIMEOUT: timeout of a request to the accrual system")
+	fs.StringVar(&c.JWTSecretKey, "j", c.JWTSecretKey, "JWT_SECRET_KEY")
+	fs.DurationVar(&c.TokenTTL, "token-ttl", c.TokenTTL, "TOKEN_TTL: lifetime of issued tokens, 0 for tokens that never expire")
+	fs.StringVar(&c.AdminToken, "k", c.AdminToken, "ADMIN_TOKEN")
+	fs.Float64Var(&c.TransferDailyLimit, "l", c.TransferDailyLimit, "TRANSFER_DAILY_LIMIT")
+	fs.IntVar(&c.BatchMaxSize, "b", c.BatchMaxSize, "ORDERS_BATCH_MAX_SIZE")
+	fs.StringVar(&c.OrderValidators, "order-validators", c.OrderValidators, "ORDER_VALIDATORS: order number schemes per merchant, like *=luhn;acme=damm,length=12")
+	fs.IntVar(&c.WebhookMaxAttempts, "w", c.WebhookMaxAttempts, "WEBHOOK_MAX_ATTEMPTS")
+	fs.StringVar(&c.AccrualCallbackSecret, "s", c.AccrualCallbackSecret, "ACCRUAL_CALLBACK_SECRET")
+	fs.DurationVar(&c.ScanInterval, "i", c.ScanInterval, "SCAN_INTERVAL")
+	fs.IntVar(&c.ScanWorkers, "scan-workers", c.ScanWorkers, "SCAN_WORKERS: concurrent requests to the accrual system per scan")
+	fs.DurationVar(&c.ReconcileInterval, "R", c.ReconcileInterval, "RECONCILE_INTERVAL")
+	fs.BoolVar(&c.SwaggerUI, "swagger", c.SwaggerUI, "SWAGGER_UI: serve Swagger UI at /api/docs, the browser loads it from SWAGGER_UI_ASSETS")
+	fs.StringVar(&c.SwaggerUIAssets, "swagger-assets", c.SwaggerUIAssets, "SWAGGER_UI_ASSETS: URL or path of a swagger-ui-dist copy, unpkg by default")
+	fs.StringVar(&c.V1Sunset, "v1-sunset", c.V1Sunset, "API_V1_SUNSET: date when /api/v1 is removed")
+	fs.DurationVar(&c.ShutdownDelay, "shutdown-delay", c.ShutdownDelay, "SHUTDOWN_DELAY: how long /readyz fails before the server stops")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "SHUTDOWN_TIMEOUT: how long requests in flight may take to finish on shutdown")
+}
+
+// GetConfig loads the configuration for the command line of the process and validates it.
+func GetConfig() (*Config, error) {
 
-	flag.Parse()
-	err := env.Parse(cfg)
+	cfg, err := Load(os.Args[1:])
 	if err != nil {
 		return cfg, err
 	}
 
-	return cfg, nil
+	return cfg, cfg.Validate()
+}
+
+// Load merges the defaults, the config file, the environment and args. It doesn't validate the result.
+func Load(args []string) (*Config, error) {
+
+	// flags are parsed first to find the config file, but applied last
+	parsed := Default()
+	fs := flag.NewFlagSet("gophermart", flag.ContinueOnError)
+	bind(fs, &parsed)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "CONFIG_FILE: YAML or TOML config file")
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg := Default()
+	if *file != "" {
+		err = loadFile(*file, &cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = env.Parse(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	explicit := flag.NewFlagSet("", flag.ContinueOnError)
+	bind(explicit, &cfg)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" || err != nil {
+			return
+		}
+		err = explicit.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// IsHelp reports whether Load stopped because help was requested.
+func IsHelp(err error) bool {
+	return errors.Is(err, flag.ErrHelp)
 }
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile reads a YAML or TOML file, told apart by the extension, onto cfg.
+// Unknown keys are errors, so a typo doesn't silently fall back to a default.
+func loadFile(path string, cfg *Config) error {
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(b), cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, k := range undecoded {
+				keys = append(keys, k.String())
+			}
+			sort.Strings(keys)
+			return fmt.Errorf("%s: unknown keys: %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("%s: config file must be .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
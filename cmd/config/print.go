@@ -0,0 +1,52 @@
+package config
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// Redacted returns a copy of c safe to show: secrets and the database password are masked.
+func (c Config) Redacted() Config {
+
+	mask := func(s *string) {
+		if *s != "" {
+			*s = redacted
+		}
+	}
+	mask(&c.JWTSecretKey)
+	mask(&c.AdminToken)
+	mask(&c.AccrualCallbackSecret)
+
+	// both URL and key=value connection strings are accepted by pgx
+	u, err := url.Parse(c.DatabaseURI)
+	if err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			c.DatabaseURI = u.String()
+		}
+	} else {
+		c.DatabaseURI = dsnPassword.ReplaceAllString(c.DatabaseURI, "${1}"+redacted)
+	}
+
+	return c
+}
+
+// Print writes c as a YAML config file with secrets redacted.
+func Print(w io.Writer, c Config) error {
+
+	b, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/ratelimit"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// ValidationError lists every invalid setting, so they can be fixed at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the settings the service can't start without.
+func (c Config) Validate() error {
+
+	v := &ValidationError{}
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+		}
+	}
+	address := func(name, addr string, optional bool) {
+		if optional && addr == "" {
+			return
+		}
+		_, _, err := net.SplitHostPort(addr)
+		check(err == nil, "%s must be host:port, got %q", name, addr)
+	}
+
+	address("RUN_ADDRESS", c.RunAddress, false)
+	address("GRPC_ADDRESS", c.GRPCAddress, true)
+	address("METRICS_ADDRESS", c.MetricsAddress, true)
+
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE go together")
+	check(c.TLSClientCAFile == "" || c.TLSCertFile != "", "TLS_CLIENT_CA_FILE requires TLS_CERT_FILE")
+	check(c.ReadHeaderTimeout > 0, "READ_HEADER_TIMEOUT must be positive")
+	check(c.ReadTimeout >= 0 && c.WriteTimeout >= 0 && c.IdleTimeout >= 0, "READ_TIMEOUT, WRITE_TIMEOUT and IDLE_TIMEOUT must not be negative")
+	check(c.MaxBodyBytes > 0, "MAX_BODY_BYTES must be positive")
+	check(c.BatchMaxBodyBytes > 0, "BATCH_MAX_BODY_BYTES must be positive")
+	check(c.MaxDecompressedBytes > 0, "MAX_DECOMPRESSED_BYTES must be positive")
+	check(c.CompressMinSize >= 0, "COMPRESS_MIN_SIZE must not be negative")
+
+	switch c.RateLimitStore {
+	case ratelimit.StoreMemory:
+	case ratelimit.StorePostgres:
+		check(c.DatabaseURI != "", "DATABASE_URI is required with the postgres rate limit store")
+	default:
+		check(false, "RATE_LIMIT_STORE must be memory or postgres, got %q", c.RateLimitStore)
+	}
+	policy := func(name, spec string) {
+		_, err := ratelimit.ParsePolicy(name, spec)
+		check(err == nil, "%s: %v", name, err)
+	}
+	policy("RATE_LIMIT_IP", c.RateLimitIP)
+	policy("RATE_LIMIT_USER", c.RateLimitUser)
+	policy("RATE_LIMIT_AUTH", c.RateLimitAuth)
+	policy("RATE_LIMIT_ORDERS", c.RateLimitOrders)
+
+	switch c.Storage {
+	case "postgres":
+		check(c.DatabaseURI != "", "DATABASE_URI is required with postgres storage")
+	case "memory":
+	default:
+		check(false, "STORAGE must be postgres or memory, got %q", c.Storage)
+	}
+
+	u, err := url.Parse(c.AccrualSystemAddress)
+	check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		"ACCRUAL_SYSTEM_ADDRESS must be an http(s) URL, got %q", c.AccrualSystemAddress)
+	check(c.AccrualTimeout > 0, "ACCRUAL_TIMEOUT must be positive")
+
+	check(c.JWTSecretKey != "", "JWT_SECRET_KEY is required")
+	check(c.TokenTTL >= 0, "TOKEN_TTL must not be negative")
+
+	check(c.TransferDailyLimit >= 0, "TRANSFER_DAILY_LIMIT must not be negative")
+	check(c.BatchMaxSize > 0, "ORDERS_BATCH_MAX_SIZE must be positive")
+	_, err = validation.ParseRegistry(c.OrderValidators)
+	check(err == nil, "ORDER_VALIDATORS: %v", err)
+	check(c.WebhookMaxAttempts > 0, "WEBHOOK_MAX_ATTEMPTS must be positive")
+
+	check(c.ScanInterval > 0, "SCAN_INTERVAL must be positive")
+	check(c.ScanWorkers > 0, "SCAN_WORKERS must be positive")
+	check(c.ReconcileInterval > 0, "RECONCILE_INTERVAL must be positive")
+
+	switch c.TraceExporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		check(c.TraceFile != "", "TRACE_FILE is required with the file trace exporter")
+	default:
+		check(false, "TRACE_EXPORTER must be none, otlp, stdout or file, got %q", c.TraceExporter)
+	}
+	check(c.TraceSampleRatio >= 0 && c.TraceSampleRatio <= 1, "TRACE_SAMPLE_RATIO must be from 0 to 1")
+
+	check(c.LogFormat == "text" || c.LogFormat == "json", "LOG_FORMAT must be text or json, got %q", c.LogFormat)
+	_, err = logrus.ParseLevel(c.LogLevel)
+	check(err == nil, "LOG_LEVEL must be trace, debug, info, warn or error, got %q", c.LogLevel)
+	check(c.LogMaxSizeMB >= 0 && c.LogMaxBackups >= 0 && c.LogMaxAgeDays >= 0, "LOG_MAX_* must not be negative")
+
+	if c.SwaggerUI {
+		u, err := url.Parse(c.SwaggerUIAssets)
+		check(err == nil && (((u.Scheme == "http" || u.Scheme == "https") && u.Host != "") || (u.Scheme == "" && strings.HasPrefix(u.Path, "/"))),
+			"SWAGGER_UI_ASSETS must be an http(s) URL or an absolute path, got %q", c.SwaggerUIAssets)
+	}
+	if c.V1Sunset != "" {
+		_, err = time.Parse("2006-01-02", c.V1Sunset)
+		check(err == nil, "API_V1_SUNSET must be a date like 2006-01-02, got %q", c.V1Sunset)
+	}
+	check(c.ShutdownDelay >= 0, "SHUTDOWN_DELAY must not be negative")
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+
+	if len(v.Problems) > 0 {
+		return v
+	}
+
+	return nil
+}
@@ -2,11 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/broker"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/grpcserver"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/notifier"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/scanner"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/server"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/tracing"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
 )
 
@@ -14,24 +24,115 @@ func main() {
 
 	logger := logging.GetLogger()
 
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		printConfig(os.Args[3:])
+		return
+	}
+
 	cfg, err := config.GetConfig()
+	if config.IsHelp(err) {
+		return
+	}
 	if err != nil {
 		logger.Fatalf("GetConfig: %s", err)
 	}
 
+	err = logging.Setup(logging.Options{
+		Format:     cfg.LogFormat,
+		Level:      cfg.LogLevel,
+		File:       cfg.LogFile,
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+		MaxAgeDays: cfg.LogMaxAgeDays,
+	})
+	if err != nil {
+		logger.Fatalf("logging.Setup: %s", err)
+	}
+
+	shutdown, err := tracing.Setup(*cfg)
+	if err != nil {
+		logger.Fatalf("tracing.Setup: %s", err)
+	}
+	defer shutdown(context.Background())
+
+	// validated with the config, parsed once for every server
+	registry, err := validation.ParseRegistry(cfg.OrderValidators)
+	if err != nil {
+		logger.Fatalf("ORDER_VALIDATORS: %s", err)
+	}
+
 	rep, err := repository.NewReps(*cfg)
 	if err != nil {
 		logger.Fatalf("NewReps: %s", err)
 	}
+	validators := service.NewValidators(rep.Merchants, registry)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	go func() {
 		scanner.Loop(ctx, *rep, *cfg, *logger)
 	}()
+	go func() {
+		notifier.Loop(ctx, *rep, *cfg, *logger)
+	}()
+
+	hub := broker.NewHub()
+	go func() {
+		broker.Run(ctx, hub, *rep, *logger)
+	}()
 
-	err = server.StartServer(*rep, *cfg, *logger)
+	// the gRPC server stops along with the HTTP one
+	grpcDone := make(chan struct{})
+	if cfg.GRPCAddress != "" {
+		go func() {
+			defer close(grpcDone)
+			err := grpcserver.StartServer(ctx, *rep, hub, validators, *cfg, *logger)
+			if err != nil {
+				logger.Fatalf("grpc StartServer: %s", err)
+			}
+		}()
+	} else {
+		close(grpcDone)
+	}
+
+	if cfg.MetricsAddress != "" {
+		go func() {
+			err := server.StartMetricsServer(*cfg, *logger)
+			if err != nil {
+				logger.Fatalf("StartMetricsServer: %s", err)
+			}
+		}()
+	}
+
+	err = server.StartServer(ctx, *rep, hub, validators, *cfg, *logger)
 	if err != nil {
 		logger.Fatalf("StartServer: %s", err)
 	}
+	<-grpcDone
+}
+
+// printConfig implements `gophermart config print [flags]`: it shows the
+// merged configuration with secrets redacted and whether it is valid.
+func printConfig(args []string) {
+
+	cfg, err := config.Load(args)
+	if config.IsHelp(err) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	err = config.Print(os.Stdout, *cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -1,15 +1,22 @@
 package authjwt
 
 import (
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"time"
+
 	"github.com/golang-jwt/jwt/v4"
 )
 
-func EncodeJWT(ID, key string) (string, error) {
+// EncodeJWT issues a token for the user ID that expires after ttl. A zero ttl never expires.
+func EncodeJWT(ID, key string, ttl time.Duration) (string, error) {
 
 	var claims = jwt.RegisteredClaims{
 		ID: ID,
 	}
+	if ttl > 0 {
+		now := time.Now()
+		claims.IssuedAt = jwt.NewNumericDate(now)
+		claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	ss, err := token.SignedString([]byte(key))
@@ -20,14 +27,19 @@ func EncodeJWT(ID, key string) (string, error) {
 	return ss, nil
 }
 
-func ParseJWTWithClaims(token string, cfg config.Config) (string, error) {
+// ValidateJWT checks the token signature and returns the user ID from its claims.
+func ValidateJWT(token, key string) (string, error) {
 
-	tkn, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return cfg.JWTSecretKey, nil
+	claims := &jwt.RegisteredClaims{}
+	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(key), nil
 	})
-	if claims, ok := tkn.Claims.(*jwt.RegisteredClaims); ok {
-		return claims.ID, nil
-	} else {
+	if err != nil {
 		return "", err
 	}
+	if !tkn.Valid || claims.ID == "" {
+		return "", jwt.ErrTokenInvalidClaims
+	}
+
+	return claims.ID, nil
 }
@@ -0,0 +1,87 @@
+package broker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+const bufferSize = 16
+
+// Hub fans user events out to the streams subscribed on this replica.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan model.UserEvent]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[string]map[chan model.UserEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel with the user's events and a function to unsubscribe.
+// The channel is closed when the subscriber falls behind.
+func (h *Hub) Subscribe(userID string) (<-chan model.UserEvent, func()) {
+
+	ch := make(chan model.UserEvent, bufferSize)
+
+	h.mu.Lock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan model.UserEvent]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		h.remove(userID, ch)
+		h.mu.Unlock()
+	}
+}
+
+// Publish never blocks: a subscriber whose buffer is full is closed instead
+// of missing the event, so its client reconnects and replays the gap from
+// the event log with Last-Event-ID.
+func (h *Hub) Publish(event model.UserEvent) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			h.remove(event.UserID, ch)
+			close(ch)
+		}
+	}
+}
+
+// remove must be called with the lock held.
+func (h *Hub) remove(userID string, ch chan model.UserEvent) {
+
+	delete(h.subs[userID], ch)
+	if len(h.subs[userID]) == 0 {
+		delete(h.subs, userID)
+	}
+}
+
+// Run feeds the hub from the database notifications and reconnects on failure until ctx is cancelled.
+func Run(ctx context.Context, hub *Hub, rep repository.Pool, logger logging.Logger) {
+
+	for {
+		err := rep.Events.Listen(ctx, hub.Publish)
+		select {
+		case <-ctx.Done():
+			logger.Info("broker stopped")
+			return
+		case <-time.After(time.Second):
+			logger.Printf("broker:%v", err)
+		}
+	}
+}
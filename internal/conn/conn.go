@@ -5,20 +5,29 @@ import (
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/tracing"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-func NewConnection(cfg config.Config) *pgxpool.Pool {
+func NewConnection(cfg config.Config) (*pgxpool.Pool, error) {
 
-	logger := logging.GetLogger()
+	pcfg, err := pgxpool.ParseConfig(cfg.DatabaseURI)
+	if err != nil {
+		return nil, err
+	}
+	// pgx v4 has no tracer hook, queries are traced through its log
+	pcfg.ConnConfig.Logger = tracing.PgxTracer{}
+	pcfg.ConnConfig.LogLevel = pgx.LogLevelInfo
+	// timestamp columns default to current_timestamp: keep them in UTC whatever the server zone is
+	pcfg.ConnConfig.RuntimeParams["timezone"] = "UTC"
 
 	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
 	defer cancel()
-	pool, err := pgxpool.Connect(ctx, cfg.DatabaseURI)
+	pool, err := pgxpool.ConnectConfig(ctx, pcfg)
 	if err != nil {
-		logger.Fatalf("Unable to connect to database: %v\n", err)
+		return nil, err
 	}
 
-	return pool
+	return pool, nil
 }
@@ -0,0 +1,248 @@
+// Package e2e walks through the HTTP API described in SPECIFICATION.md.
+// The server runs with its real routing and scanner against an in-process
+// fake of the accrual system, so the checks cover every status code and
+// JSON shape of the specification.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/broker"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/scanner"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/server"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// Accrual is a fake of the accrual system. Orders it doesn't know about are
+// answered with 204.
+type Accrual struct {
+	mu     sync.Mutex
+	orders map[string]model.ResponseForScanner
+}
+
+func NewAccrual() *Accrual {
+	return &Accrual{
+		orders: make(map[string]model.ResponseForScanner),
+	}
+}
+
+// Set makes the fake report the result for the order.
+func (a *Accrual) Set(res model.ResponseForScanner) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.orders[res.Order] = res
+}
+
+func (a *Accrual) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	number := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+
+	a.mu.Lock()
+	res, ok := a.orders[number]
+	a.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// Server is the API under test together with its accrual fake.
+type Server struct {
+	URL     string
+	Accrual *Accrual
+}
+
+// Start serves the API from rep until the test ends.
+func Start(t *testing.T, rep repository.Pool) *Server {
+
+	t.Helper()
+
+	accrual := NewAccrual()
+	accrualSrv := httptest.NewServer(accrual)
+	t.Cleanup(accrualSrv.Close)
+
+	cfg := config.Default()
+	cfg.AccrualSystemAddress = accrualSrv.URL
+	cfg.JWTSecretKey = "e2e"
+	cfg.ScanInterval = 10 * time.Millisecond
+	// log to stdout, never to logs/ next to the tests
+	cfg.LogFile = ""
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	logger := logging.Logger{Entry: logrus.NewEntry(l)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go scanner.Loop(ctx, rep, cfg, logger)
+
+	registry, err := validation.ParseRegistry(cfg.OrderValidators)
+	if err != nil {
+		t.Fatalf("ParseRegistry: %v", err)
+	}
+	validators := service.NewValidators(rep.Merchants, registry)
+
+	srv := httptest.NewServer(server.NewRouter(rep, broker.NewHub(), validators, cfg, logger))
+	t.Cleanup(srv.Close)
+
+	return &Server{
+		URL:     srv.URL,
+		Accrual: accrual,
+	}
+}
+
+type response struct {
+	code   int
+	header http.Header
+	body   []byte
+}
+
+func (s *Server) do(t *testing.T, method, path, token, contentType, body string) response {
+
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response{
+		code:   resp.StatusCode,
+		header: resp.Header,
+		body:   b,
+	}
+}
+
+type step struct {
+	name        string
+	method      string
+	path        string
+	token       string
+	contentType string
+	body        string
+	code        int
+}
+
+func (s *Server) run(t *testing.T, steps []step) {
+
+	t.Helper()
+
+	for _, st := range steps {
+		res := s.do(t, st.method, st.path, st.token, st.contentType, st.body)
+		if res.code != st.code {
+			t.Errorf("%s: %s %s returned %d, want %d", st.name, st.method, st.path, res.code, st.code)
+		}
+		if st.code >= http.StatusBadRequest {
+			problemShape(t, st.name, res)
+		}
+	}
+}
+
+// decode checks that the body is JSON holding the expected number of objects.
+func decode(t *testing.T, res response, count int) []map[string]interface{} {
+
+	t.Helper()
+
+	if ct := res.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type is %q, want application/json", ct)
+	}
+
+	var list []map[string]interface{}
+	if err := json.Unmarshal(res.body, &list); err != nil {
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(res.body, &obj); err != nil {
+			t.Fatalf("body %s is not JSON: %v", res.body, err)
+		}
+		list = []map[string]interface{}{obj}
+	}
+
+	if len(list) != count {
+		t.Fatalf("got %d objects in %s, want %d", len(list), res.body, count)
+	}
+
+	return list
+}
+
+// shape checks that the object has exactly the given keys.
+func shape(t *testing.T, obj map[string]interface{}, keys ...string) {
+
+	t.Helper()
+
+	if len(obj) != len(keys) {
+		t.Errorf("object %v has keys other than %v", obj, keys)
+	}
+	for _, key := range keys {
+		if _, ok := obj[key]; !ok {
+			t.Errorf("object %v has no %q", obj, key)
+		}
+	}
+}
+
+// problemShape checks that an error is reported as application/problem+json.
+func problemShape(t *testing.T, name string, res response) {
+
+	t.Helper()
+
+	if ct := res.header.Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("%s: Content-Type is %q, want %s", name, ct, problem.ContentType)
+		return
+	}
+
+	p := problem.Problem{}
+	if err := json.Unmarshal(res.body, &p); err != nil {
+		t.Errorf("%s: body %s is not a problem: %v", name, res.body, err)
+		return
+	}
+	if p.Status != res.code || p.Code == "" || p.RequestID == "" {
+		t.Errorf("%s: problem %+v is incomplete", name, p)
+	}
+}
+
+func rfc3339(t *testing.T, v interface{}) {
+
+	t.Helper()
+
+	s, _ := v.(string)
+	if _, err := time.Parse(time.RFC3339, s); err != nil {
+		t.Errorf("%v is not RFC3339: %v", v, err)
+	}
+}
@@ -0,0 +1,317 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/repotest"
+)
+
+// Run walks register → login → upload → accrual → balance → withdraw → history.
+func Run(t *testing.T, rep repository.Pool) {
+
+	s := Start(t, rep)
+
+	const (
+		processed    = "12345678903"
+		invalid      = "79927398713"
+		notLuhn      = "12345678904"
+		withdrawal   = "2377225624"
+		credentials  = `{"login":"gopher","password":"secret"}`
+		jsonType     = "application/json"
+		textType     = "text/plain"
+		otherCreds   = `{"login":"other","password":"secret"}`
+		wrongPass    = `{"login":"gopher","password":"wrong"}`
+		missingLogin = `{"login":"nobody","password":"secret"}`
+	)
+
+	s.run(t, []step{
+		{name: "register without JSON type", method: http.MethodPost, path: "/api/user/register", contentType: textType, body: credentials, code: http.StatusBadRequest},
+		{name: "register with bad JSON", method: http.MethodPost, path: "/api/user/register", contentType: jsonType, body: "{", code: http.StatusBadRequest},
+		{name: "register with empty login", method: http.MethodPost, path: "/api/user/register", contentType: jsonType, body: `{"password":"secret"}`, code: http.StatusBadRequest},
+	})
+
+	res := s.do(t, http.MethodPost, "/api/user/register", "", jsonType, credentials)
+	if res.code != http.StatusOK {
+		t.Fatalf("register returned %d, want %d", res.code, http.StatusOK)
+	}
+	if res.header.Get("Authorization") == "" {
+		t.Fatal("register didn't authenticate the user")
+	}
+
+	s.run(t, []step{
+		{name: "register taken login", method: http.MethodPost, path: "/api/user/register", contentType: jsonType, body: credentials, code: http.StatusConflict},
+		{name: "login with bad JSON", method: http.MethodPost, path: "/api/user/login", contentType: jsonType, body: "{", code: http.StatusBadRequest},
+		{name: "login with wrong password", method: http.MethodPost, path: "/api/user/login", contentType: jsonType, body: wrongPass, code: http.StatusUnauthorized},
+		{name: "login with unknown login", method: http.MethodPost, path: "/api/user/login", contentType: jsonType, body: missingLogin, code: http.StatusUnauthorized},
+	})
+
+	res = s.do(t, http.MethodPost, "/api/user/login", "", jsonType, credentials)
+	token := res.header.Get("Authorization")
+	if res.code != http.StatusOK || token == "" {
+		t.Fatalf("login returned %d with token %q", res.code, token)
+	}
+
+	other := s.do(t, http.MethodPost, "/api/user/register", "", jsonType, otherCreds).header.Get("Authorization")
+
+	s.run(t, []step{
+		{name: "orders without token", method: http.MethodGet, path: "/api/user/orders", code: http.StatusUnauthorized},
+		{name: "orders with bad token", method: http.MethodGet, path: "/api/user/orders", token: "Bearer nope", code: http.StatusUnauthorized},
+		{name: "upload without token", method: http.MethodPost, path: "/api/user/orders", contentType: textType, body: processed, code: http.StatusUnauthorized},
+		{name: "balance without token", method: http.MethodGet, path: "/api/user/balance", code: http.StatusUnauthorized},
+		{name: "withdraw without token", method: http.MethodPost, path: "/api/user/balance/withdraw", contentType: jsonType, body: `{"order":"2377225624","sum":1}`, code: http.StatusUnauthorized},
+		{name: "withdraw without token and body", method: http.MethodPost, path: "/api/user/balance/withdraw", contentType: textType, code: http.StatusUnauthorized},
+		{name: "withdrawals without token", method: http.MethodGet, path: "/api/user/withdrawals", code: http.StatusUnauthorized},
+		{name: "no orders yet", method: http.MethodGet, path: "/api/user/orders", token: token, code: http.StatusNoContent},
+		{name: "no withdrawals yet", method: http.MethodGet, path: "/api/user/withdrawals", token: token, code: http.StatusNoContent},
+		{name: "upload as JSON", method: http.MethodPost, path: "/api/user/orders", token: token, contentType: jsonType, body: processed, code: http.StatusBadRequest},
+		{name: "upload non-digits", method: http.MethodPost, path: "/api/user/orders", token: token, contentType: textType, body: "abc", code: http.StatusBadRequest},
+		{name: "upload failing Luhn", method: http.MethodPost, path: "/api/user/orders", token: token, contentType: textType, body: notLuhn, code: http.StatusUnprocessableEntity},
+		{name: "upload new order", method: http.MethodPost, path: "/api/user/orders", token: token, contentType: textType, body: processed, code: http.StatusAccepted},
+		{name: "upload same order again", method: http.MethodPost, path: "/api/user/orders", token: token, contentType: textType, body: processed, code: http.StatusOK},
+		{name: "upload order of another user", method: http.MethodPost, path: "/api/user/orders", token: other, contentType: textType, body: processed, code: http.StatusConflict},
+		{name: "upload second order", method: http.MethodPost, path: "/api/user/orders", token: token, contentType: textType, body: invalid, code: http.StatusAccepted},
+	})
+
+	// order numbers are unique per merchant
+	if _, err := rep.Merchants.AddMerchant(context.Background(), model.Merchant{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatalf("AddMerchant: %v", err)
+	}
+	s.run(t, []step{
+		{name: "upload for unknown merchant", method: http.MethodPost, path: "/api/user/orders?merchant=nobody", token: other, contentType: textType, body: processed, code: http.StatusUnprocessableEntity},
+		{name: "upload number of another merchant", method: http.MethodPost, path: "/api/user/orders?merchant=acme", token: other, contentType: textType, body: processed, code: http.StatusAccepted},
+		{name: "upload same number of merchant again", method: http.MethodPost, path: "/api/user/orders?merchant=acme", token: other, contentType: textType, body: processed, code: http.StatusOK},
+		{name: "upload number of merchant of another user", method: http.MethodPost, path: "/api/user/orders?merchant=acme", token: token, contentType: textType, body: processed, code: http.StatusConflict},
+	})
+
+	res = s.do(t, http.MethodGet, "/api/user/balance", token, "", "")
+	balance := decode(t, res, 1)
+	shape(t, balance[0], "current", "withdrawn")
+	if balance[0]["current"] != 0.0 || balance[0]["withdrawn"] != 0.0 {
+		t.Errorf("balance before accrual is %v", balance[0])
+	}
+
+	s.Accrual.Set(model.ResponseForScanner{Order: processed, Status: "PROCESSED", Accrual: 500})
+	s.Accrual.Set(model.ResponseForScanner{Order: invalid, Status: "INVALID"})
+
+	var list []map[string]interface{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res = s.do(t, http.MethodGet, "/api/user/orders", token, "", "")
+		if res.code != http.StatusOK {
+			t.Fatalf("orders returned %d, want %d", res.code, http.StatusOK)
+		}
+		if bytes.Contains(res.body, []byte("PROCESSED")) && bytes.Contains(res.body, []byte("INVALID")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("accrual results weren't picked up: %s", res.body)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	list = decode(t, res, 2)
+	for _, o := range list {
+		rfc3339(t, o["uploaded_at"])
+		switch o["number"] {
+		case processed:
+			shape(t, o, "number", "status", "accrual", "uploaded_at")
+			if o["status"] != "PROCESSED" || o["accrual"] != 500.0 {
+				t.Errorf("processed order is %v", o)
+			}
+		case invalid:
+			// no accrual, so the field is omitted
+			shape(t, o, "number", "status", "uploaded_at")
+			if o["status"] != "INVALID" {
+				t.Errorf("invalid order is %v", o)
+			}
+		default:
+			t.Errorf("unexpected order %v", o)
+		}
+	}
+
+	res = s.do(t, http.MethodGet, "/api/user/balance", token, "", "")
+	balance = decode(t, res, 1)
+	shape(t, balance[0], "current", "withdrawn")
+	if balance[0]["current"] != 500.0 || balance[0]["withdrawn"] != 0.0 {
+		t.Errorf("balance after accrual is %v", balance[0])
+	}
+
+	s.run(t, []step{
+		{name: "withdraw with bad JSON", method: http.MethodPost, path: "/api/user/balance/withdraw", token: token, contentType: jsonType, body: "{", code: http.StatusBadRequest},
+		{name: "withdraw to order failing Luhn", method: http.MethodPost, path: "/api/user/balance/withdraw", token: token, contentType: jsonType, body: `{"order":"12345678904","sum":1}`, code: http.StatusUnprocessableEntity},
+		{name: "withdraw negative sum", method: http.MethodPost, path: "/api/user/balance/withdraw", token: token, contentType: jsonType, body: `{"order":"2377225624","sum":-5}`, code: http.StatusBadRequest},
+		{name: "withdraw more than balance", method: http.MethodPost, path: "/api/user/balance/withdraw", token: token, contentType: jsonType, body: `{"order":"2377225624","sum":751}`, code: http.StatusPaymentRequired},
+		{name: "withdraw", method: http.MethodPost, path: "/api/user/balance/withdraw", token: token, contentType: jsonType, body: `{"order":"2377225624","sum":200.5}`, code: http.StatusOK},
+		{name: "other user has no withdrawals", method: http.MethodGet, path: "/api/user/withdrawals", token: other, code: http.StatusNoContent},
+	})
+
+	res = s.do(t, http.MethodGet, "/api/user/balance", token, "", "")
+	balance = decode(t, res, 1)
+	shape(t, balance[0], "current", "withdrawn")
+	if balance[0]["current"] != 299.5 || balance[0]["withdrawn"] != 200.5 {
+		t.Errorf("balance after withdrawal is %v", balance[0])
+	}
+
+	res = s.do(t, http.MethodGet, "/api/user/withdrawals", token, "", "")
+	if res.code != http.StatusOK {
+		t.Fatalf("withdrawals returned %d, want %d", res.code, http.StatusOK)
+	}
+	list = decode(t, res, 1)
+	shape(t, list[0], "order", "sum", "processed_at")
+	if list[0]["order"] != withdrawal || list[0]["sum"] != 200.5 {
+		t.Errorf("withdrawal is %v", list[0])
+	}
+	rfc3339(t, list[0]["processed_at"])
+}
+
+// RunV2 checks what v2 changes: decimal strings, paged lists and deprecation of v1.
+func RunV2(t *testing.T, rep repository.Pool) {
+
+	s := Start(t, rep)
+
+	const (
+		order    = "4561261212345467"
+		jsonType = "application/json"
+		textType = "text/plain"
+	)
+
+	res := s.do(t, http.MethodPost, "/api/v2/user/register", "", jsonType, `{"login":"v2","password":"secret"}`)
+	token := res.header.Get("Authorization")
+	if res.code != http.StatusOK || token == "" {
+		t.Fatalf("register returned %d with token %q", res.code, token)
+	}
+	if res.header.Get("Deprecation") != "" {
+		t.Error("v2 response is marked deprecated")
+	}
+
+	res = s.do(t, http.MethodGet, "/api/v2/user/orders", token, "", "")
+	if res.code != http.StatusOK {
+		t.Fatalf("empty orders returned %d, want %d", res.code, http.StatusOK)
+	}
+	page := decode(t, res, 1)
+	shape(t, page[0], "orders")
+
+	s.run(t, []step{
+		{name: "upload", method: http.MethodPost, path: "/api/v2/user/orders", token: token, contentType: textType, body: order, code: http.StatusAccepted},
+		{name: "withdraw float sum", method: http.MethodPost, path: "/api/v2/user/balance/withdraw", token: token, contentType: jsonType, body: `{"order":"2377225624","sum":1}`, code: http.StatusBadRequest},
+		{name: "withdraw three decimals", method: http.MethodPost, path: "/api/v2/user/balance/withdraw", token: token, contentType: jsonType, body: `{"order":"2377225624","sum":"1.005"}`, code: http.StatusBadRequest},
+	})
+
+	s.Accrual.Set(model.ResponseForScanner{Order: order, Status: "PROCESSED", Accrual: 729.98})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res = s.do(t, http.MethodGet, "/api/v2/user/orders", token, "", "")
+		if bytes.Contains(res.body, []byte("PROCESSED")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("accrual result wasn't picked up: %s", res.body)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !bytes.Contains(res.body, []byte(`"accrual":"729.98"`)) {
+		t.Errorf("accrual isn't a decimal string: %s", res.body)
+	}
+
+	res = s.do(t, http.MethodPost, "/api/v2/user/balance/withdraw", token, jsonType, `{"order":"2377225624","sum":"29.98"}`)
+	if res.code != http.StatusOK {
+		t.Fatalf("withdraw returned %d, want %d: %s", res.code, http.StatusOK, res.body)
+	}
+
+	res = s.do(t, http.MethodGet, "/api/v2/user/balance", token, "", "")
+	balance := decode(t, res, 1)
+	if balance[0]["current"] != "700.00" || balance[0]["withdrawn"] != "29.98" {
+		t.Errorf("balance is %v", balance[0])
+	}
+
+	res = s.do(t, http.MethodGet, "/api/v2/user/withdrawals?limit=1", token, "", "")
+	page = decode(t, res, 1)
+	shape(t, page[0], "withdrawals")
+
+	for _, path := range []string{"/api/user/balance", "/api/v1/user/balance"} {
+		res = s.do(t, http.MethodGet, path, token, "", "")
+		if res.code != http.StatusOK {
+			t.Fatalf("%s returned %d, want %d", path, res.code, http.StatusOK)
+		}
+		if !strings.HasPrefix(res.header.Get("Deprecation"), "@") {
+			t.Errorf("%s: Deprecation is %q", path, res.header.Get("Deprecation"))
+		}
+		if res.header.Get("Link") != `</api/v2/user/balance>; rel="successor-version"` {
+			t.Errorf("%s: Link is %q", path, res.header.Get("Link"))
+		}
+		balance = decode(t, res, 1)
+		if balance[0]["current"] != 700.0 {
+			t.Errorf("%s: v1 balance is %v", path, balance[0])
+		}
+	}
+}
+
+// RunBatch walks through batch uploads. Only a first CSV row naming the
+// number column is a header; any other is checked like the rest.
+func RunBatch(t *testing.T, rep repository.Pool) {
+
+	s := Start(t, rep)
+
+	res := s.do(t, http.MethodPost, "/api/user/register", "", "application/json", `{"login":"batch","password":"secret"}`)
+	token := res.header.Get("Authorization")
+	if res.code != http.StatusOK || token == "" {
+		t.Fatalf("register returned %d with token %q", res.code, token)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "header", body: "Order_Number\n378282246310005\n", want: []string{model.BatchAccepted}},
+		{name: "header after a byte order mark", body: "\ufeffnumber,note\n378282246310005,again\n", want: []string{model.BatchUploaded}},
+		{name: "invalid first row", body: "12a\n5555555555554444\n", want: []string{model.BatchBadFormat, model.BatchAccepted}},
+		{name: "failing first row", body: "5555555555554445\n5555555555554444\n", want: []string{model.BatchInvalid, model.BatchUploaded}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := s.do(t, http.MethodPost, "/api/user/orders/batch", token, "text/csv", tt.body)
+			if res.code != http.StatusOK {
+				t.Fatalf("batch returned %d, want %d: %s", res.code, http.StatusOK, res.body)
+			}
+			results := decode(t, res, len(tt.want))
+			for i, want := range tt.want {
+				if results[i]["status"] != want {
+					t.Errorf("result %d is %v, want status %s", i, results[i], want)
+				}
+			}
+		})
+	}
+}
+
+// TestMemory runs the walk-throughs against the in-memory store.
+func TestMemory(t *testing.T) {
+	t.Run("v1", func(t *testing.T) { Run(t, *repository.NewMemoryReps()) })
+	t.Run("v2", func(t *testing.T) { RunV2(t, *repository.NewMemoryReps()) })
+	t.Run("batch", func(t *testing.T) { RunBatch(t, *repository.NewMemoryReps()) })
+}
+
+// TestPostgres runs the walk-through against a throwaway PostgreSQL.
+func TestPostgres(t *testing.T) {
+
+	cfg := config.Default()
+	cfg.DatabaseURI = repotest.Postgres(t)
+	cfg.Storage = repository.StoragePostgres
+
+	rep, err := repository.NewReps(cfg)
+	if err != nil {
+		t.Fatalf("NewReps: %v", err)
+	}
+
+	t.Run("v1", func(t *testing.T) { Run(t, *rep) })
+	t.Run("v2", func(t *testing.T) { RunV2(t, *rep) })
+	t.Run("batch", func(t *testing.T) { RunBatch(t, *rep) })
+}
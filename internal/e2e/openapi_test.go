@@ -0,0 +1,51 @@
+package e2e
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/api/openapi"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/broker"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/server"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// TestOpenAPIDrift fails when the user routes and the OpenAPI documents disagree.
+func TestOpenAPIDrift(t *testing.T) {
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	rep := *repository.NewMemoryReps()
+	r := server.NewRouter(rep, broker.NewHub(), service.NewValidators(rep.Merchants, nil), config.Default(), logging.Logger{Entry: logrus.NewEntry(l)})
+
+	tests := []struct {
+		mount string
+		spec  []byte
+		base  string
+	}{
+		{mount: "/api/user", spec: openapi.Spec, base: "/api/user"},
+		{mount: "/api/v1/user", spec: openapi.Spec, base: "/api/user"},
+		{mount: "/api/v2/user", spec: openapi.SpecV2, base: "/api/v2/user"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mount, func(t *testing.T) {
+			doc, err := openapi.Load(tt.spec)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			drift, err := doc.Drift(r, tt.mount, tt.base)
+			if err != nil {
+				t.Fatalf("Drift: %v", err)
+			}
+			for _, d := range drift {
+				t.Error(d)
+			}
+		})
+	}
+}
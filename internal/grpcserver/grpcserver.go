@@ -0,0 +1,420 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/api/loyalty"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/broker"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/pagination"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/server"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type ctxKey struct{}
+
+// public methods are served without a token
+var public = map[string]bool{
+	loyalty.LoyaltyService_Register_FullMethodName: true,
+	loyalty.LoyaltyService_Login_FullMethodName:    true,
+}
+
+type Server struct {
+	loyalty.UnimplementedLoyaltyServiceServer
+	auth    *service.AuthService
+	orders  *service.OrderService
+	balance *service.BalanceService
+	rep     repository.Pool
+	hub     *broker.Hub
+	logger  logging.Logger
+	// done ends the streams when the server shuts down
+	done <-chan struct{}
+}
+
+// StartServer serves the gRPC API until ctx is done, like the HTTP API: it
+// waits cfg.ShutdownDelay, then lets the calls in flight finish within
+// cfg.ShutdownTimeout. With a certificate configured it serves TLS.
+func StartServer(ctx context.Context, rep repository.Pool, hub *broker.Hub, validators *service.Validators, cfg config.Config, logger logging.Logger) error {
+
+	lis, err := net.Listen("tcp", cfg.GRPCAddress)
+	if err != nil {
+		return err
+	}
+
+	auth := service.NewAuthService(rep.Users, cfg.JWTSecretKey, cfg.TokenTTL)
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryRecover(logger), unaryAuth(auth)),
+		grpc.ChainStreamInterceptor(streamRecover(logger), streamAuth(auth)),
+	}
+	if cfg.TLSCertFile != "" {
+		tc, err := server.TLSConfig(cfg, logger)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tc)))
+	}
+
+	s := grpc.NewServer(opts...)
+	loyalty.RegisterLoyaltyServiceServer(s, &Server{
+		auth:    auth,
+		orders:  service.NewOrderService(rep.Orders, validators),
+		balance: service.NewBalanceService(rep.Orders, rep.Withdrawn, rep.Transfers, rep.Adjustments, rep.Users, cfg.TransferDailyLimit),
+		rep:     rep,
+		hub:     hub,
+		logger:  logger,
+		done:    ctx.Done(),
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+
+		logger.Info("grpc server shutting down")
+		time.Sleep(cfg.ShutdownDelay)
+
+		stopped := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(cfg.ShutdownTimeout):
+			logger.Error("grpc GracefulStop: timed out")
+			s.Stop()
+		}
+	}()
+
+	if cfg.TLSCertFile != "" {
+		logger.Info("grpc server running with TLS")
+	} else {
+		logger.Info("grpc server running")
+	}
+	err = s.Serve(lis)
+	if err != nil {
+		return err
+	}
+	<-done
+
+	return nil
+}
+
+func authenticate(ctx context.Context, auth *service.AuthService) (context.Context, error) {
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) < 1 {
+		return ctx, status.Error(codes.Unauthenticated, "missing token")
+	}
+
+	token := strings.TrimPrefix(values[0], "Bearer ")
+	userID, err := auth.Authenticate(token)
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return context.WithValue(ctx, ctxKey{}, userID), nil
+}
+
+func unaryAuth(auth *service.AuthService) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+		if public[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		ctx, err := authenticate(ctx, auth)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// unaryRecover turns a panic in a call into codes.Internal, as
+// middleware.Recoverer does for the HTTP API, so one bad call doesn't take
+// the server down.
+func unaryRecover(logger logging.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Errorf("grpc %s: panic: %v\n%s", info.FullMethod, p, debug.Stack())
+				resp, err = nil, status.Error(codes.Internal, "internal error")
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+func streamRecover(logger logging.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Errorf("grpc %s: panic: %v\n%s", info.FullMethod, p, debug.Stack())
+				err = status.Error(codes.Internal, "internal error")
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamAuth(auth *service.AuthService) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		ctx, err := authenticate(ss.Context(), auth)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, authStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func userID(ctx context.Context) string {
+	ID, _ := ctx.Value(ctxKey{}).(string)
+	return ID
+}
+
+// toStatus maps domain errors to gRPC status codes and masks the rest.
+func (s *Server) toStatus(err error) error {
+
+	switch {
+	case errors.Is(err, service.ErrBadRequest), errors.Is(err, service.ErrBadOrderNumber),
+		errors.Is(err, service.ErrInvalidOrder), errors.Is(err, service.ErrSelfTransfer):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrLoginTaken), errors.Is(err, service.ErrOrderConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrBadCredentials), errors.Is(err, service.ErrUnauthorized):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, model.ErrInsufficientFunds):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	s.logger.Error(err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+func (s *Server) Register(ctx context.Context, req *loyalty.Credentials) (*loyalty.Token, error) {
+
+	token, err := s.auth.Register(ctx, req.Login, req.Password)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+
+	return &loyalty.Token{Token: token}, nil
+}
+
+func (s *Server) Login(ctx context.Context, req *loyalty.Credentials) (*loyalty.Token, error) {
+
+	token, err := s.auth.Login(ctx, req.Login, req.Password)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+
+	return &loyalty.Token{Token: token}, nil
+}
+
+func (s *Server) UploadOrder(ctx context.Context, req *loyalty.UploadOrderRequest) (*loyalty.UploadOrderResponse, error) {
+
+	accepted, err := s.orders.Upload(ctx, userID(ctx), "", req.Number)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+
+	return &loyalty.UploadOrderResponse{Accepted: accepted}, nil
+}
+
+func page(req *loyalty.ListRequest) (model.Page, error) {
+
+	p := model.Page{Limit: int(req.Limit)}
+	if p.Limit > pagination.MaxLimit {
+		p.Limit = pagination.MaxLimit
+	}
+	if req.Cursor != "" {
+		p.After = &model.Cursor{}
+		if err := pagination.DecodeCursor(req.Cursor, p.After); err != nil {
+			return p, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	return p, nil
+}
+
+func nextCursor(next *model.Cursor) (string, error) {
+
+	if next == nil {
+		return "", nil
+	}
+
+	return pagination.EncodeCursor(next)
+}
+
+func (s *Server) ListOrders(ctx context.Context, req *loyalty.ListRequest) (*loyalty.ListOrdersResponse, error) {
+
+	p, err := page(req)
+	if err != nil {
+		return nil, err
+	}
+
+	list, next, err := s.orders.List(ctx, userID(ctx), p)
+	if err != nil && !errors.Is(err, model.ErrNotExist) {
+		return nil, s.toStatus(err)
+	}
+
+	resp := &loyalty.ListOrdersResponse{}
+	resp.NextCursor, err = nextCursor(next)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+
+	for _, order := range list {
+		resp.Orders = append(resp.Orders, &loyalty.Order{
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: timestamppb.New(order.UploadedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *Server) GetBalance(ctx context.Context, req *loyalty.GetBalanceRequest) (*loyalty.Balance, error) {
+
+	data, err := s.balance.Balance(ctx, userID(ctx))
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+
+	return &loyalty.Balance{
+		Current:   data.Current,
+		Withdrawn: data.Withdrawn,
+	}, nil
+}
+
+func (s *Server) Withdraw(ctx context.Context, req *loyalty.WithdrawRequest) (*loyalty.WithdrawResponse, error) {
+
+	if req.Sum <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "sum must be positive")
+	}
+
+	err := s.balance.Withdraw(ctx, userID(ctx), req.Order, req.Sum)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+
+	return &loyalty.WithdrawResponse{}, nil
+}
+
+func (s *Server) ListWithdrawals(ctx context.Context, req *loyalty.ListRequest) (*loyalty.ListWithdrawalsResponse, error) {
+
+	p, err := page(req)
+	if err != nil {
+		return nil, err
+	}
+
+	list, next, err := s.balance.Withdrawals(ctx, userID(ctx), p)
+	if err != nil && !errors.Is(err, model.ErrNotExist) {
+		return nil, s.toStatus(err)
+	}
+
+	resp := &loyalty.ListWithdrawalsResponse{}
+	resp.NextCursor, err = nextCursor(next)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+
+	for _, w := range list {
+		resp.Withdrawals = append(resp.Withdrawals, &loyalty.Withdrawal{
+			Order:       w.Order,
+			Sum:         w.Accrual,
+			ProcessedAt: timestamppb.New(w.ProcessedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *Server) WatchOrders(req *loyalty.WatchOrdersRequest, stream loyalty.LoyaltyService_WatchOrdersServer) error {
+
+	ctx := stream.Context()
+	lastID := req.LastEventId
+
+	ch, unsubscribe := s.hub.Subscribe(userID(ctx))
+	defer unsubscribe()
+
+	send := func(event model.UserEvent) error {
+		if event.ID <= lastID {
+			return nil
+		}
+		lastID = event.ID
+		if event.Type != model.UserEventOrder {
+			return nil
+		}
+		return stream.Send(&loyalty.OrderEvent{
+			Id:        event.ID,
+			Number:    event.Order,
+			Status:    event.Status,
+			Accrual:   event.Accrual,
+			CreatedAt: timestamppb.New(event.CreatedAt),
+		})
+	}
+
+	if lastID > 0 {
+		missed, err := s.rep.Events.GetEventsAfter(ctx, userID(ctx), lastID)
+		if err != nil {
+			return s.toStatus(err)
+		}
+		for _, event := range missed {
+			if err = send(event); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "stream fell behind, resume with last_event_id")
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down, resume with last_event_id")
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package grpcserver
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/api/loyalty"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testLogger() logging.Logger {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return logging.Logger{Entry: logrus.NewEntry(l)}
+}
+
+func TestWithdrawSum(t *testing.T) {
+
+	rep := repository.NewMemoryReps()
+	s := &Server{
+		balance: service.NewBalanceService(rep.Orders, rep.Withdrawn, rep.Transfers, rep.Adjustments, rep.Users, 0),
+		logger:  testLogger(),
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "u1")
+
+	for _, sum := range []float64{-500, 0} {
+		_, err := s.Withdraw(ctx, &loyalty.WithdrawRequest{Order: "12345678903", Sum: sum})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Withdraw(%v) = %v, want InvalidArgument", sum, err)
+		}
+	}
+
+	_, err := s.Withdraw(ctx, &loyalty.WithdrawRequest{Order: "12345678903", Sum: 10})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Withdraw(10) on an empty balance = %v, want FailedPrecondition", err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+
+	logger := testLogger()
+
+	unary := unaryRecover(logger)
+	resp, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	if resp != nil || status.Code(err) != codes.Internal {
+		t.Errorf("unary panic = %v, %v, want nil, Internal", resp, err)
+	}
+
+	resp, err = unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return "ok", nil
+		})
+	if resp != "ok" || err != nil {
+		t.Errorf("unary = %v, %v, want ok, nil", resp, err)
+	}
+
+	stream := streamRecover(logger)
+	err = stream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/test/Stream"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			panic("boom")
+		})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("stream panic = %v, want Internal", err)
+	}
+
+	err = stream(nil, nil, &grpc.StreamServerInfo{FullMethod: "/test/Stream"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			return nil
+		})
+	if err != nil {
+		t.Errorf("stream = %v, want nil", err)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/scanner"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/signature"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"github.com/go-chi/chi"
+)
+
+const signatureTolerance = 5 * time.Minute
+
+// AccrualAuth accepts the accrual system either by a verified client certificate
+// or by an HMAC signature of the body made with the callback secret.
+func AccrualAuth(cfg config.Config, logger logging.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			logger := logger.Ctx(r.Context())
+
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if cfg.AccrualCallbackSecret == "" {
+				logger.Printf("%v", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "client certificate required")
+				return
+			}
+
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				bodyError(w, r, logger, err)
+				return
+			}
+
+			if !signature.Verify(cfg.AccrualCallbackSecret, r.Header.Get("X-Accrual-Timestamp"),
+				r.Header.Get("X-Accrual-Signature"), b, signatureTolerance) {
+				logger.Printf("%v", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "missing or invalid signature")
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(b))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AccrualCallbackHandler takes results pushed by the accrual system: a single object or an array.
+// The route names the merchant whose accrual system pushes, none for the
+// default one; a merchant in the body is ignored, the same number may be an
+// order of several merchants.
+func AccrualCallbackHandler(rep repository.Pool, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		merchant := chi.URLParam(r, "merchant")
+		if merchant != "" {
+			_, err := rep.Merchants.GetMerchant(r.Context(), merchant)
+			if errors.Is(err, model.ErrNotExist) {
+				logger.Printf("%v", http.StatusNotFound)
+				problem.Write(w, r, http.StatusNotFound, problem.CodeUnknownMerchant, "unknown merchant "+merchant)
+				return
+			} else if err != nil {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, r, logger, err)
+			return
+		}
+
+		list := make([]model.ResponseForScanner, 0)
+		b = bytes.TrimSpace(b)
+		if len(b) > 0 && b[0] == '[' {
+			err = json.Unmarshal(b, &list)
+		} else {
+			data := model.ResponseForScanner{}
+			err = json.Unmarshal(b, &data)
+			list = append(list, data)
+		}
+		if err != nil {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
+			return
+		}
+
+		for _, data := range list {
+			data.Merchant = merchant
+			err = scanner.Apply(r.Context(), rep, data)
+			if err != nil {
+				if errors.Is(err, model.ErrBadStatus) {
+					logger.Printf("%v", http.StatusUnprocessableEntity)
+					problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeUnknownStatus, "unknown status of order "+data.Order,
+						problem.FieldError{Field: "status", Reason: "is not one of REGISTERED, INVALID, PROCESSING, PROCESSED"})
+					return
+				} else if errors.Is(err, model.ErrNotExist) {
+					// the order could have been pushed for another installation
+					logger.Printf("accrual callback: unknown order %s of merchant %q", data.Order, merchant)
+					continue
+				} else {
+					problem.Internal(w, r, logger, err)
+					return
+				}
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
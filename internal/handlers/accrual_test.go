@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+func testLogger() logging.Logger {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return logging.Logger{Entry: logrus.NewEntry(l)}
+}
+
+// The same number is an order of the default merchant and of acme, each
+// crediting another user: a callback credits the order of its route only.
+func TestAccrualCallbackMerchant(t *testing.T) {
+
+	ctx := context.Background()
+	rep := repository.NewMemoryReps()
+	if _, err := rep.Merchants.AddMerchant(ctx, model.Merchant{ID: "acme", Name: "Acme"}); err != nil {
+		t.Fatalf("AddMerchant: %v", err)
+	}
+	if err := rep.Orders.AddOrder(ctx, "default-user", "", "12345678903"); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	if err := rep.Orders.AddOrder(ctx, "acme-user", "acme", "12345678903"); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Post("/accrual/callback", AccrualCallbackHandler(*rep, testLogger()))
+	r.Post("/accrual/merchants/{merchant}/callback", AccrualCallbackHandler(*rep, testLogger()))
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		code       int
+		defaultSum float64
+		acmeSum    float64
+	}{
+		{name: "merchant route", path: "/accrual/merchants/acme/callback",
+			body: `{"order":"12345678903","status":"PROCESSED","accrual":30}`, code: http.StatusOK, acmeSum: 30},
+		{name: "merchant in the body is ignored", path: "/accrual/callback",
+			body: `{"merchant":"acme","order":"12345678903","status":"PROCESSED","accrual":20}`, code: http.StatusOK, defaultSum: 20, acmeSum: 30},
+		{name: "unknown merchant", path: "/accrual/merchants/nobody/callback",
+			body: `{"order":"12345678903","status":"PROCESSED","accrual":10}`, code: http.StatusNotFound, defaultSum: 20, acmeSum: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Fatalf("POST %s returned %d, want %d", tt.path, w.Code, tt.code)
+			}
+
+			for user, want := range map[string]float64{"default-user": tt.defaultSum, "acme-user": tt.acmeSum} {
+				got, err := rep.Orders.GetAccrualSum(ctx, user)
+				if err != nil {
+					t.Fatalf("GetAccrualSum(%s): %v", user, err)
+				}
+				if got != want {
+					t.Errorf("accrual of %s = %v, want %v", user, got, want)
+				}
+			}
+		})
+	}
+}
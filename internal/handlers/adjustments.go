@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"github.com/go-chi/chi"
+)
+
+// AdjustmentHandler lets an admin credit or debit the balance of the user in the path.
+func AdjustmentHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	balance := newBalanceService(rep, cfg)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, r, logger, err)
+			return
+		}
+
+		data := model.Adjustment{}
+		err = json.Unmarshal(b, &data)
+		if err != nil {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
+			return
+		}
+
+		err = balance.Adjust(r.Context(), chi.URLParam(r, "login"), data.Reference, data.Sum)
+		if err != nil {
+			if errors.Is(err, service.ErrBadRequest) {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeValidationFailed, "adjustment is invalid", fields(err)...)
+				return
+			} else if errors.Is(err, service.ErrUnknownUser) {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such user")
+				return
+			} else if errors.Is(err, model.ErrInsufficientFunds) {
+				logger.Printf("%v", http.StatusPaymentRequired)
+				problem.Write(w, r, http.StatusPaymentRequired, problem.CodeInsufficientPoints, "not enough points on the balance")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		logger.Infof("balance of %s adjusted by %v: %s", chi.URLParam(r, "login"), data.Sum, data.Reference)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// ReversalHandler lets an admin return a withdrawal of the user in the path to their balance.
+func ReversalHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	balance := newBalanceService(rep, cfg)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		err := balance.Reverse(r.Context(), chi.URLParam(r, "login"), chi.URLParam(r, "order"))
+		if err != nil {
+			if errors.Is(err, service.ErrUnknownUser) {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such user")
+				return
+			} else if errors.Is(err, service.ErrUnknownWithdrawal) {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such withdrawal")
+				return
+			} else if errors.Is(err, service.ErrAlreadyReversed) {
+				logger.Printf("%v", http.StatusConflict)
+				problem.Write(w, r, http.StatusConflict, problem.CodeAlreadyReversed, "withdrawal is reversed already")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		logger.Infof("withdrawal %s of %s reversed", chi.URLParam(r, "order"), chi.URLParam(r, "login"))
+		w.WriteHeader(http.StatusOK)
+	}
+}
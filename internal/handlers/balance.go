@@ -2,72 +2,41 @@ package handlers
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/authjwt"
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
 )
 
+func newBalanceService(rep repository.Pool, cfg config.Config) *service.BalanceService {
+	return service.NewBalanceService(rep.Orders, rep.Withdrawn, rep.Transfers, rep.Adjustments, rep.Users, cfg.TransferDailyLimit)
+}
+
 func BalanceHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
 
-		token := r.Header.Get("Authorization")
-		userID, err := authjwt.ParseJWTWithClaims(token, cfg)
-		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	balance := newBalanceService(rep, cfg)
 
-		list, err := rep.Orders.GetOrdersByUserID(r.Context(), userID)
-		if err != nil {
-			if errors.Is(err, model.ErrNotExist) {
-				list = append(list, model.Order{
-					Accrual: 0.0,
-				})
-			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
+	return func(w http.ResponseWriter, r *http.Request) {
 
-		current := 0.0
-		for _, order := range list {
-			current += order.Accrual
-		}
+		logger := logger.Ctx(r.Context())
 
-		wList, err := rep.Withdrawn.GetWithdrawnOrdersByUserID(r.Context(), userID)
+		data, err := balance.Balance(r.Context(), userID(r))
 		if err != nil {
-			if errors.Is(err, model.ErrNotExist) {
-				wList = append(wList, model.Withdrawn{
-					Accrual: 0.0,
-				})
-			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		withdrawn := 0.0
-		for _, order := range wList {
-			withdrawn += order.Accrual
+			problem.Internal(w, r, logger, err)
+			return
 		}
 
-		data := model.Response{
-			Current:   current - withdrawn,
-			Withdrawn: withdrawn,
+		var body any = data
+		if version(r) == V2 {
+			body = toBalanceV2(data)
 		}
 
-		resp, err := json.Marshal(data)
+		resp, err := json.Marshal(body)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Internal(w, r, logger, err)
 			return
 		}
 
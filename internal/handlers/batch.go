@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+var errBatchTooLarge = errors.New("batch too large")
+
+// csvHeaders are the names a CSV header row may give the order number column.
+// Any other first row is data, and an invalid number in it is reported as such.
+var csvHeaders = map[string]bool{
+	"number":       true,
+	"order":        true,
+	"order number": true,
+	"order_number": true,
+	"order id":     true,
+	"order_id":     true,
+}
+
+func PostOrdersBatchHandler(rep repository.Pool, validators *service.Validators, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	orders := service.NewOrderService(rep.Orders, validators)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		// ValidateRequest has already checked the media type
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, r, logger, err)
+			return
+		}
+
+		numbers, err := parseBatch(mediaType, b, cfg.BatchMaxSize)
+		if err != nil {
+			if errors.Is(err, errBatchTooLarge) {
+				logger.Printf("%v", http.StatusRequestEntityTooLarge)
+				problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBatchTooLarge, fmt.Sprintf("no more than %d orders per batch", cfg.BatchMaxSize))
+				return
+			}
+			// the parser error quotes the body: keep it in the log
+			logger.Printf("%v: %v", http.StatusBadRequest, err)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "batch is not a valid "+mediaType+" list of order numbers")
+			return
+		}
+		if len(numbers) < 1 {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "batch is empty")
+			return
+		}
+
+		merchant := r.URL.Query().Get("merchant")
+		results, err := orders.UploadBatch(r.Context(), userID(r), merchant, numbers)
+		if err != nil {
+			if errors.Is(err, service.ErrUnknownMerchant) {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeUnknownMerchant, "unknown merchant "+merchant)
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		resp, err := json.Marshal(results)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
+
+// parseBatch accepts a JSON array, newline-delimited text or CSV with the order number in the first column.
+func parseBatch(mediaType string, b []byte, max int) ([]string, error) {
+
+	numbers := make([]string, 0)
+	add := func(number string) error {
+		number = strings.TrimSpace(number)
+		if number == "" {
+			return nil
+		}
+		if max > 0 && len(numbers) >= max {
+			return errBatchTooLarge
+		}
+		numbers = append(numbers, number)
+		return nil
+	}
+
+	switch mediaType {
+	case "application/json":
+		items := make([]any, 0)
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err := dec.Decode(&items)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			number := ""
+			switch v := item.(type) {
+			case string:
+				number = v
+			case json.Number:
+				number = v.String()
+			default:
+				return nil, fmt.Errorf("unexpected item: %v", item)
+			}
+			if err = add(number); err != nil {
+				return nil, err
+			}
+		}
+	case "text/plain":
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		for sc.Scan() {
+			if err := add(sc.Text()); err != nil {
+				return nil, err
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	case "text/csv":
+		cr := csv.NewReader(bytes.NewReader(b))
+		cr.FieldsPerRecord = -1
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, record := range records {
+			if len(record) < 1 {
+				continue
+			}
+			if i == 0 {
+				// spreadsheets may start the file with a byte order mark
+				record[0] = strings.TrimPrefix(record[0], "\ufeff")
+				if csvHeaders[strings.ToLower(strings.TrimSpace(record[0]))] {
+					continue
+				}
+			}
+			if err = add(record[0]); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content type: %s", mediaType)
+	}
+
+	return numbers, nil
+}
@@ -0,0 +1,215 @@
+// Package codec implements the HTTP content codings the API speaks: gzip,
+// deflate, br and zstd, in both directions.
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Brotli   = "br"
+	Zstd     = "zstd"
+	Identity = "identity"
+)
+
+// Supported lists the codings in the order they are preferred when a
+// client accepts several of them equally.
+var Supported = []string{Zstd, Brotli, Gzip, Deflate}
+
+// ErrUnsupported is returned for a content coding that isn't in Supported.
+var ErrUnsupported = errors.New("unsupported content coding")
+
+// MalformedError is returned by a decoding reader when the body isn't valid in its coding.
+type MalformedError struct {
+	Encoding string
+	Err      error
+}
+
+func (e *MalformedError) Error() string {
+	return fmt.Sprintf("malformed %s body: %v", e.Encoding, e.Err)
+}
+
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+// Encoder compresses into the writer it was reset to.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders are pooled per coding: a zstd or brotli encoder allocates
+// much more than a response usually takes.
+var encoders = map[string]*sync.Pool{
+	Gzip: {New: func() any {
+		e, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return e
+	}},
+	Deflate: {New: func() any {
+		e, _ := zlib.NewWriterLevel(nil, zlib.BestSpeed)
+		return e
+	}},
+	Brotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, 4)
+	}},
+	Zstd: {New: func() any {
+		e, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedFastest))
+		return e
+	}},
+}
+
+// NewEncoder returns an encoder of encoding writing to w. Release it with PutEncoder once closed.
+func NewEncoder(encoding string, w io.Writer) (Encoder, error) {
+
+	pool, ok := encoders[encoding]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	e := pool.Get().(Encoder)
+	e.Reset(w)
+
+	return e, nil
+}
+
+// PutEncoder returns a closed encoder to its pool.
+func PutEncoder(encoding string, e Encoder) {
+
+	e.Reset(io.Discard)
+	encoders[encoding].Put(e)
+}
+
+// NewDecoder returns a reader decoding r from encoding. zstd frames declare
+// the window the decoder has to allocate, so it is kept within limit.
+func NewDecoder(encoding string, r io.Reader, limit int64) (io.ReadCloser, error) {
+
+	var dec io.ReadCloser
+	switch encoding {
+	case Gzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, &MalformedError{Encoding: encoding, Err: err}
+		}
+		dec = gz
+	case Deflate:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, &MalformedError{Encoding: encoding, Err: err}
+		}
+		dec = zr
+	case Brotli:
+		dec = io.NopCloser(brotli.NewReader(r))
+	case Zstd:
+		window := uint64(limit)
+		if window < zstd.MinWindowSize {
+			window = zstd.MinWindowSize
+		}
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(limit)), zstd.WithDecoderMaxWindow(window))
+		if err != nil {
+			return nil, err
+		}
+		dec = zr.IOReadCloser()
+	default:
+		return nil, ErrUnsupported
+	}
+
+	return &decoder{encoding: encoding, ReadCloser: dec}, nil
+}
+
+// decoder reports a broken stream as MalformedError. The errors of reading
+// the body itself, like the one of http.MaxBytesReader, are passed on as is.
+type decoder struct {
+	io.ReadCloser
+	encoding string
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+
+	n, err := d.ReadCloser.Read(p)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return n, err
+	}
+
+	return n, &MalformedError{Encoding: d.encoding, Err: err}
+}
+
+// Normalize lower-cases a content coding and maps the legacy x-gzip to gzip.
+func Normalize(encoding string) string {
+
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "x-gzip" {
+		return Gzip
+	}
+
+	return encoding
+}
+
+// Negotiate picks the coding of a response from an Accept-Encoding header:
+// the supported coding of the highest q-value, ties going to the order of
+// Supported. It returns Identity when nothing supported is acceptable.
+func Negotiate(accept string) string {
+
+	if accept == "" {
+		return Identity
+	}
+
+	q := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = Normalize(coding)
+		if coding == "" {
+			continue
+		}
+
+		weight := 1.0
+		params = strings.TrimSpace(params)
+		if v, ok := strings.CutPrefix(params, "q="); ok {
+			w, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				continue
+			}
+			weight = w
+		}
+
+		if coding == "*" {
+			wildcard = weight
+			continue
+		}
+		q[coding] = weight
+	}
+
+	best, bestQ := Identity, 0.0
+	for _, coding := range Supported {
+		weight, ok := q[coding]
+		if !ok {
+			weight = wildcard
+		}
+		if weight > bestQ {
+			best, bestQ = coding, weight
+		}
+	}
+
+	return best
+}
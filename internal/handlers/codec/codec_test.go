@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: Identity},
+		{accept: "gzip", want: Gzip},
+		{accept: "GZIP", want: Gzip},
+		{accept: "x-gzip", want: Gzip},
+		{accept: "deflate", want: Deflate},
+		{accept: "compress", want: Identity},
+		{accept: "identity", want: Identity},
+		// ties go to the order of Supported
+		{accept: "gzip, deflate, br", want: Brotli},
+		{accept: "deflate, gzip", want: Gzip},
+		{accept: "*", want: Zstd},
+		// the highest q-value wins
+		{accept: "gzip;q=0.5, br;q=0.4", want: Gzip},
+		{accept: "br;q=0.9, zstd;q=0.8", want: Brotli},
+		{accept: "deflate;q=1.0, zstd;q=0.999", want: Deflate},
+		{accept: "*;q=0.5, gzip;q=0.8", want: Gzip},
+		{accept: "gzip ; q=0.2, deflate;q=0.3", want: Deflate},
+		// q=0 excludes a coding, even against the wildcard
+		{accept: "gzip;q=0", want: Identity},
+		{accept: "br;q=0, gzip", want: Gzip},
+		{accept: "*, zstd;q=0", want: Brotli},
+		{accept: "*;q=0", want: Identity},
+		{accept: "*;q=0, deflate", want: Deflate},
+		// a malformed q-value drops its coding only
+		{accept: "zstd;q=high, gzip", want: Gzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := Negotiate(tt.accept); got != tt.want {
+				t.Errorf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+
+	body := strings.Repeat(`{"number":"12345678903","status":"PROCESSED"}`, 100)
+	for _, encoding := range Supported {
+		t.Run(encoding, func(t *testing.T) {
+
+			var buf bytes.Buffer
+			enc, err := NewEncoder(encoding, &buf)
+			if err != nil {
+				t.Fatalf("NewEncoder: %v", err)
+			}
+			if _, err := io.WriteString(enc, body); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if err := enc.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			PutEncoder(encoding, enc)
+			if buf.Len() >= len(body) {
+				t.Errorf("%s took %d bytes to %d", encoding, len(body), buf.Len())
+			}
+
+			dec, err := NewDecoder(encoding, &buf, 1<<20)
+			if err != nil {
+				t.Fatalf("NewDecoder: %v", err)
+			}
+			defer dec.Close()
+			got, err := io.ReadAll(dec)
+			if err != nil || string(got) != body {
+				t.Errorf("decoded %d bytes, %v, want the %d encoded", len(got), err, len(body))
+			}
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+
+	if _, err := NewEncoder("compress", io.Discard); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("NewEncoder(compress): got %v, want %v", err, ErrUnsupported)
+	}
+	if _, err := NewDecoder("compress", strings.NewReader("x"), 1<<20); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("NewDecoder(compress): got %v, want %v", err, ErrUnsupported)
+	}
+
+	for _, encoding := range Supported {
+		t.Run(encoding, func(t *testing.T) {
+
+			garbage := strings.NewReader(strings.Repeat("not compressed at all ", 10))
+			dec, err := NewDecoder(encoding, garbage, 1<<20)
+			if err == nil {
+				defer dec.Close()
+				_, err = io.ReadAll(dec)
+			}
+			var malformed *MalformedError
+			if !errors.As(err, &malformed) || malformed.Encoding != encoding {
+				t.Errorf("decoding garbage: got %v, want a MalformedError of %s", err, encoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/handlers/codec"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// Compress encodes responses in the coding negotiated from Accept-Encoding.
+// Only responses of a type in types are compressed, a type like "text/*"
+// covering all its subtypes. Responses shorter than minSize are sent as they
+// are, unless the handler flushes before that: a stream is compressed from the start.
+func Compress(types []string, minSize int) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			vary(w.Header(), "Accept-Encoding")
+
+			encoding := codec.Negotiate(r.Header.Get("Accept-Encoding"))
+			if encoding == codec.Identity || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				types:          types,
+				minSize:        minSize,
+			}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// vary adds name to the Vary header unless it is there already.
+func vary(h http.Header, name string) {
+
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", name)
+}
+
+// compressWriter holds the response back until it knows whether to
+// compress it: when the body reaches minSize, the handler flushes or returns.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	types    []string
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	enc     codec.Encoder
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+
+	if w.decided || w.status != 0 {
+		return
+	}
+	// informational responses go out at once, the final one follows
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusSwitchingProtocols {
+		_ = w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.minSize {
+		err := w.decide(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Flush sends what is buffered and compressed so far.
+func (w *compressWriter) Flush() {
+
+	if !w.decided {
+		err := w.decide(true)
+		if err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		err := w.enc.Flush()
+		if err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends a response too short to compress and finishes the encoding.
+func (w *compressWriter) Close() error {
+
+	if !w.decided {
+		err := w.decide(false)
+		if err != nil {
+			return err
+		}
+	}
+	if w.enc == nil {
+		return nil
+	}
+
+	err := w.enc.Close()
+	codec.PutEncoder(w.encoding, w.enc)
+	w.enc = nil
+
+	return err
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the header, compressing the body if it may, and the buffered body.
+func (w *compressWriter) decide(compress bool) error {
+
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if compress && h.Get("Content-Encoding") == "" && w.compressible(h.Get("Content-Type")) {
+		enc, err := codec.NewEncoder(w.encoding, w.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		w.enc = enc
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+
+	return err
+}
+
+func (w *compressWriter) compressible(contentType string) bool {
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range w.types {
+		if t == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Decompress decodes request bodies in any supported coding as they are read.
+// Both the encoded body and the decoded one are limited to limit bytes; a body
+// that turns out to be broken is answered by bodyError.
+func Decompress(limit int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			logger := logging.GetLogger().Ctx(r.Context())
+
+			header := r.Header.Get("Content-Encoding")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// codings are listed in the order they were applied
+			body := http.MaxBytesReader(w, r.Body, limit)
+			closers := []io.Closer{body}
+			codings := strings.Split(header, ",")
+			for i := len(codings) - 1; i >= 0; i-- {
+				encoding := codec.Normalize(codings[i])
+				if encoding == codec.Identity {
+					continue
+				}
+				dec, err := codec.NewDecoder(encoding, body, limit)
+				if err != nil {
+					for _, c := range closers {
+						c.Close()
+					}
+					decodeError(w, r, logger, encoding, err)
+					return
+				}
+				body = dec
+				closers = append(closers, dec)
+			}
+
+			r.Body = &decodedBody{Reader: http.MaxBytesReader(w, io.NopCloser(body), limit), closers: closers}
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// decodedBody closes the decoders and the original body along with it.
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if cerr := b.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+func decodeError(w http.ResponseWriter, r *http.Request, logger logging.Logger, encoding string, err error) {
+
+	if errors.Is(err, codec.ErrUnsupported) {
+		logger.Printf("%v", http.StatusUnsupportedMediaType)
+		w.Header().Set("Accept-Encoding", strings.Join(codec.Supported, ", "))
+		problem.Write(w, r, http.StatusUnsupportedMediaType, problem.CodeUnsupportedEncoding,
+			fmt.Sprintf("Content-Encoding %s is not supported", encoding))
+		return
+	}
+
+	bodyError(w, r, logger, err)
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/handlers/codec"
+)
+
+func encode(t *testing.T, encoding string, body []byte) []byte {
+
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc, err := codec.NewEncoder(encoding, &buf)
+	if err != nil {
+		t.Fatalf("NewEncoder(%s): %v", encoding, err)
+	}
+	if _, err := enc.Write(body); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	codec.PutEncoder(encoding, enc)
+
+	return buf.Bytes()
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+
+	t.Helper()
+
+	dec, err := codec.NewDecoder(encoding, bytes.NewReader(body), 1<<20)
+	if err != nil {
+		t.Fatalf("NewDecoder(%s): %v", encoding, err)
+	}
+	defer dec.Close()
+	b, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", encoding, err)
+	}
+
+	return string(b)
+}
+
+func TestCompress(t *testing.T) {
+
+	const minSize = 100
+	long := strings.Repeat(`{"order":"12345678903"}`, 10)
+	short := long[:minSize-1]
+
+	tests := []struct {
+		name        string
+		accept      string
+		status      int
+		contentType string
+		encoded     string
+		body        string
+		flush       bool
+		want        string
+	}{
+		{name: "gzip", accept: "gzip", contentType: "application/json", body: long, want: codec.Gzip},
+		{name: "deflate", accept: "deflate", contentType: "application/json", body: long, want: codec.Deflate},
+		{name: "br", accept: "br", contentType: "application/json", body: long, want: codec.Brotli},
+		{name: "zstd", accept: "zstd", contentType: "application/json", body: long, want: codec.Zstd},
+		{name: "preferred", accept: "gzip;q=0.5, br", contentType: "application/json", body: long, want: codec.Brotli},
+		{name: "at min size", accept: "gzip", contentType: "application/json", body: long[:minSize], want: codec.Gzip},
+		{name: "below min size", accept: "gzip", contentType: "application/json", body: short},
+		{name: "type by prefix", accept: "gzip", contentType: "text/csv; charset=utf-8", body: long, want: codec.Gzip},
+		{name: "type not listed", accept: "gzip", contentType: "image/png", body: long},
+		{name: "no Accept-Encoding", contentType: "application/json", body: long},
+		{name: "q=0", accept: "gzip;q=0", contentType: "application/json", body: long},
+		{name: "encoded by the handler", accept: "gzip", contentType: "application/json", encoded: "br", body: long},
+		{name: "created", accept: "gzip", status: http.StatusCreated, contentType: "application/json", body: long, want: codec.Gzip},
+		{name: "no content", accept: "gzip", status: http.StatusNoContent},
+		{name: "not modified", accept: "gzip", status: http.StatusNotModified},
+		{name: "flushed below min size", accept: "gzip", contentType: "application/json", body: "[", flush: true, want: codec.Gzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			h := Compress([]string{"application/json", "text/*"}, minSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if tt.encoded != "" {
+					w.Header().Set("Content-Encoding", tt.encoded)
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				io.WriteString(w, tt.body)
+				if tt.flush {
+					w.(http.Flusher).Flush()
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if w.Code != status {
+				t.Errorf("code = %d, want %d", w.Code, status)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if tt.flush && !w.Flushed {
+				t.Error("the flush didn't reach the client")
+			}
+
+			got := w.Header().Get("Content-Encoding")
+			if tt.encoded != "" {
+				if got != tt.encoded || w.Body.String() != tt.body {
+					t.Errorf("Content-Encoding %q with %d bytes, want the handler's %q untouched", got, w.Body.Len(), tt.encoded)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" {
+				if w.Body.String() != tt.body {
+					t.Errorf("body = %q, want %q", w.Body.String(), tt.body)
+				}
+				if w.Header().Get("Content-Length") != strconv.Itoa(len(tt.body)) {
+					t.Errorf("Content-Length = %q, want %d", w.Header().Get("Content-Length"), len(tt.body))
+				}
+				return
+			}
+			if w.Header().Get("Content-Length") != "" {
+				t.Errorf("Content-Length %q is kept on a compressed body", w.Header().Get("Content-Length"))
+			}
+			if body := decodeBody(t, tt.want, w.Body.Bytes()); body != tt.body {
+				t.Errorf("decoded body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+// A stream is compressed from its first flush, and every flush sends what was written.
+func TestCompressFlush(t *testing.T) {
+
+	h := Compress([]string{"text/*"}, 1000)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{"data: 1\n\n", "data: 2\n\n"} {
+			io.WriteString(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != codec.Gzip {
+		t.Fatalf("Content-Encoding = %q, want gzip", resp.Header.Get("Content-Encoding"))
+	}
+	dec, err := codec.NewDecoder(codec.Gzip, resp.Body, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(dec)
+	if err != nil || string(b) != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("stream = %q, %v", b, err)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+
+	const limit = 1 << 16
+	body := []byte(strings.Repeat(`{"order":"12345678903"}`, 20))
+	bomb := bytes.Repeat([]byte{0}, 2*limit)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		code     int
+	}{
+		{name: "gzip", encoding: "gzip", body: encode(t, codec.Gzip, body), code: http.StatusOK},
+		{name: "x-gzip", encoding: "x-gzip", body: encode(t, codec.Gzip, body), code: http.StatusOK},
+		{name: "zlib", encoding: "deflate", body: encode(t, codec.Deflate, body), code: http.StatusOK},
+		{name: "zstd", encoding: "zstd", body: encode(t, codec.Zstd, body), code: http.StatusOK},
+		{name: "br", encoding: "br", body: encode(t, codec.Brotli, body), code: http.StatusOK},
+		{name: "gzip then br", encoding: "gzip, br", body: encode(t, codec.Brotli, encode(t, codec.Gzip, body)), code: http.StatusOK},
+		{name: "identity", encoding: "identity", body: body, code: http.StatusOK},
+		{name: "unsupported", encoding: "compress", body: body, code: http.StatusUnsupportedMediaType},
+		{name: "malformed", encoding: "gzip", body: body, code: http.StatusBadRequest},
+		{name: "decoded past the limit", encoding: "gzip", body: encode(t, codec.Gzip, bomb), code: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			h := Decompress(limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Encoding") != "" {
+					t.Errorf("Content-Encoding %q is left on the decoded request", r.Header.Get("Content-Encoding"))
+				}
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					bodyError(w, r, testLogger(), err)
+					return
+				}
+				if !bytes.Equal(b, body) {
+					t.Errorf("decoded %d bytes, want the %d encoded", len(b), len(body))
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", tt.encoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.code {
+				t.Errorf("code = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Encoding") == "" {
+				t.Error("415 doesn't list the supported codings in Accept-Encoding")
+			}
+		})
+	}
+}
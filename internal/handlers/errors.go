@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/handlers/codec"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// fields passes the service validation details on to the problem response.
+func fields(err error) []problem.FieldError {
+
+	var v *service.ValidationError
+	if !errors.As(err, &v) {
+		return nil
+	}
+
+	list := make([]problem.FieldError, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		list = append(list, problem.FieldError{Field: f.Field, Reason: f.Reason})
+	}
+
+	return list
+}
+
+// bodyError answers a failed read of the request body: a body over the limit
+// set by MaxBody or a broken compressed body is the client's fault, anything
+// else is internal.
+func bodyError(w http.ResponseWriter, r *http.Request, logger logging.Logger, err error) {
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		logger.Printf("%v", http.StatusRequestEntityTooLarge)
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge,
+			fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit))
+		return
+	}
+
+	var malformed *codec.MalformedError
+	if errors.As(err, &malformed) {
+		logger.Printf("%v", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedEncoding,
+			fmt.Sprintf("request body is not valid %s", malformed.Encoding))
+		return
+	}
+
+	problem.Internal(w, r, logger, err)
+}
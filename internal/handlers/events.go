@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/broker"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+const heartbeat = 15 * time.Second
+
+// EventsHandler streams the user's order status changes and balance updates as Server-Sent Events.
+// A reconnecting client passes Last-Event-ID and receives the events it missed.
+func EventsHandler(rep repository.Pool, hub *broker.Hub, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	balances := newBalanceService(rep, cfg)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			logger.Error("streaming unsupported")
+			problem.Write(w, r, http.StatusInternalServerError, problem.CodeStreamingUnsupported, "streaming unsupported")
+			return
+		}
+
+		lastID := int64(0)
+		if s := r.Header.Get("Last-Event-ID"); s != "" {
+			ID, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeValidationFailed, "Last-Event-ID must be a number",
+					problem.FieldError{Field: "Last-Event-ID", Reason: "is not a number"})
+				return
+			}
+			lastID = ID
+		}
+
+		user := userID(r)
+
+		// subscribe before the replay so nothing committed in between is lost
+		ch, unsubscribe := hub.Subscribe(user)
+		defer unsubscribe()
+
+		var missed []model.UserEvent
+		var err error
+		if lastID > 0 {
+			missed, err = rep.Events.GetEventsAfter(r.Context(), user, lastID)
+			if err != nil {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		// the server write timeout is meant for whole responses and would cut
+		// the stream: give every write of the stream a deadline of its own
+		rc := http.NewResponseController(w)
+		extend := func() error {
+			if cfg.WriteTimeout <= 0 {
+				return nil
+			}
+			return rc.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		}
+		if err = extend(); err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		// event IDs of one user grow in commit order, so anything at or below
+		// lastID was already sent by the replay or the stream
+		send := func(event model.UserEvent) error {
+			if event.ID <= lastID {
+				return nil
+			}
+			lastID = event.ID
+
+			if err := extend(); err != nil {
+				return err
+			}
+
+			if event.Type == model.UserEventOrder {
+				data, err := json.Marshal(event)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+				if err != nil {
+					return err
+				}
+			}
+
+			// a processed order changes the balance as well
+			if event.Type == model.UserEventBalance || event.Status == "PROCESSED" {
+				balance, err := balances.Balance(r.Context(), user)
+				if err != nil {
+					return err
+				}
+				data, err := json.Marshal(balance)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, model.UserEventBalance, data)
+				if err != nil {
+					return err
+				}
+			}
+
+			flusher.Flush()
+			return nil
+		}
+
+		for _, event := range missed {
+			if err = send(event); err != nil {
+				logger.Error(err)
+				return
+			}
+		}
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event, ok := <-ch:
+				if !ok {
+					// fell behind: the client resumes with Last-Event-ID
+					return
+				}
+				if err = send(event); err != nil {
+					logger.Error(err)
+					return
+				}
+			case <-ticker.C:
+				if err = extend(); err != nil {
+					return
+				}
+				_, err = fmt.Fprint(w, ": ping\n\n")
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/health"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// HealthzHandler answers as long as the process serves HTTP.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(`{"status":"ok"}`))
+}
+
+// ReadyzHandler reports every readiness check and answers 503 when one fails.
+func ReadyzHandler(checker *health.Checker, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		report := checker.Readiness(r.Context())
+
+		resp, err := json.Marshal(report)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		status := http.StatusOK
+		if !report.Ready() {
+			logger.Printf("%v", http.StatusServiceUnavailable)
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_, _ = w.Write(resp)
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"github.com/go-chi/chi"
+)
+
+// readMerchant decodes the JSON body of a merchant; it answers the request itself when it fails.
+func readMerchant(w http.ResponseWriter, r *http.Request, logger logging.Logger) (model.Merchant, bool) {
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		logger.Printf("%v", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeUnsupportedMediaType, "Content-Type must be application/json")
+		return model.Merchant{}, false
+	}
+
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		bodyError(w, r, logger, err)
+		return model.Merchant{}, false
+	}
+
+	data := model.Merchant{}
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		logger.Printf("%v", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
+		return model.Merchant{}, false
+	}
+
+	return data, true
+}
+
+// AddMerchantHandler registers a merchant with its own order namespace.
+func AddMerchantHandler(rep repository.Pool, validators *service.Validators, logger logging.Logger) http.HandlerFunc {
+
+	merchants := service.NewMerchantService(rep.Merchants, validators)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		data, ok := readMerchant(w, r, logger)
+		if !ok {
+			return
+		}
+
+		merchant, err := merchants.Add(r.Context(), data)
+		if err != nil {
+			if errors.Is(err, service.ErrBadRequest) {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeValidationFailed, "merchant is invalid", fields(err)...)
+				return
+			} else if errors.Is(err, service.ErrMerchantExists) {
+				logger.Printf("%v", http.StatusConflict)
+				problem.Write(w, r, http.StatusConflict, problem.CodeMerchantExists, "merchant "+data.ID+" already exists")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		resp, err := json.Marshal(merchant)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(resp)
+	}
+}
+
+// UpdateMerchantHandler replaces the settings of a merchant; the ID comes from the path.
+func UpdateMerchantHandler(rep repository.Pool, validators *service.Validators, logger logging.Logger) http.HandlerFunc {
+
+	merchants := service.NewMerchantService(rep.Merchants, validators)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		data, ok := readMerchant(w, r, logger)
+		if !ok {
+			return
+		}
+		data.ID = chi.URLParam(r, "id")
+
+		merchant, err := merchants.Update(r.Context(), data)
+		if err != nil {
+			if errors.Is(err, service.ErrBadRequest) {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeValidationFailed, "merchant is invalid", fields(err)...)
+				return
+			} else if errors.Is(err, service.ErrUnknownMerchant) {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such merchant")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		resp, err := json.Marshal(merchant)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
+
+func GetMerchantsHandler(rep repository.Pool, validators *service.Validators, logger logging.Logger) http.HandlerFunc {
+
+	merchants := service.NewMerchantService(rep.Merchants, validators)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		list, err := merchants.List(r.Context())
+		if err != nil {
+			if errors.Is(err, model.ErrNotExist) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		resp, err := json.Marshal(list)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
+
+func GetMerchantHandler(rep repository.Pool, validators *service.Validators, logger logging.Logger) http.HandlerFunc {
+
+	merchants := service.NewMerchantService(rep.Merchants, validators)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		merchant, err := merchants.Get(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			if errors.Is(err, service.ErrUnknownMerchant) {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such merchant")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		resp, err := json.Marshal(merchant)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
+
+// MerchantReportHandler sums up the orders of a merchant, optionally
+// those uploaded within the RFC 3339 bounds from (inclusive) and to.
+func MerchantReportHandler(rep repository.Pool, validators *service.Validators, logger logging.Logger) http.HandlerFunc {
+
+	merchants := service.NewMerchantService(rep.Merchants, validators)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		var from, to time.Time
+		var err error
+		q := r.URL.Query()
+		if s := q.Get("from"); s != "" {
+			from, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeBadQuery, "bad from")
+				return
+			}
+		}
+		if s := q.Get("to"); s != "" {
+			to, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeBadQuery, "bad to")
+				return
+			}
+		}
+
+		report, err := merchants.Report(r.Context(), chi.URLParam(r, "id"), from, to)
+		if err != nil {
+			if errors.Is(err, service.ErrUnknownMerchant) {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such merchant")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		resp, err := json.Marshal(report)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
@@ -1,87 +1,137 @@
 package handlers
 
 import (
-	"compress/gzip"
-	"io"
+	"context"
+	"crypto/subtle"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/handlers/gzipmid"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
 )
 
+type ctxKey struct{}
+
+// Auth rejects requests without a valid token and puts the user ID into the request context.
 func Auth(cfg config.Config, logger logging.Logger) func(next http.Handler) http.Handler {
+
+	auth := service.NewAuthService(nil, cfg.JWTSecretKey, cfg.TokenTTL)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
+			logger := logger.Ctx(r.Context())
+
 			token := r.Header.Get("Authorization")
-			if token == "" {
+			ID, err := auth.Authenticate(token)
+			if err != nil {
 				logger.Printf("%v", http.StatusUnauthorized)
-				w.WriteHeader(http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "missing or invalid token")
 				return
-			} else {
-
-				tkn, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-					return []byte(cfg.JWTSecretKey), nil
-				})
-				if err != nil || !tkn.Valid {
-					logger.Printf("%v", http.StatusUnauthorized)
-					w.WriteHeader(http.StatusUnauthorized)
-					return
-				} else {
-					w.Header().Set("Authorization", token)
-					next.ServeHTTP(w, r)
-				}
 			}
+
+			logging.AddField(r.Context(), "user_id", ID)
+			w.Header().Set("Authorization", token)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, ID)))
 		})
 	}
 }
 
-func GzipResponse(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+func userID(r *http.Request) string {
+	ID, _ := r.Context().Value(ctxKey{}).(string)
+	return ID
+}
 
-		if r.Header.Get("Accept-Encoding") == "gzip" {
-			gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
-			if err != nil {
-				io.WriteString(w, err.Error())
+// AdminAuth guards admin routes with the static token from config.
+// Admin routes are unavailable when no token is configured.
+func AdminAuth(cfg config.Config, logger logging.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			logger := logger.Ctx(r.Context())
+
+			token := r.Header.Get("X-Admin-Token")
+			if cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+				logger.Printf("%v", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "missing or invalid admin token")
 				return
 			}
-			defer gz.Close()
-			w.Header().Set("Content-Encoding", "gzip")
-			next.ServeHTTP(gzipmid.GzipWriter{ResponseWriter: w, Writer: gz}, r)
-		} else {
+
 			next.ServeHTTP(w, r)
-			return
-		}
+		})
+	}
+}
+
+// RequestID echoes the ID assigned by middleware.RequestID, so clients can quote it,
+// and attaches it to every line logged while handling the request.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		ID := middleware.GetReqID(r.Context())
+		ctx := logging.WithFields(r.Context())
+		logging.AddField(ctx, "request_id", ID)
+
+		w.Header().Set(middleware.RequestIDHeader, ID)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func GzipRequest(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
+// AccessLog logs every request once it is answered.
+func AccessLog(logger logging.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		logger := logging.GetLogger()
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
-		if r.Header.Get("Content-Encoding") == "gzip" {
-			b, err := io.ReadAll(r.Body)
-			if err != nil {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
 			}
-			data, err := gzipmid.DecompressGZIP(b)
-			if err != nil {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+			logger.Ctx(r.Context()).WithFields(logrus.Fields{
+				"method":   r.Method,
+				"path":     r.URL.Path,
+				"status":   status,
+				"bytes":    ww.BytesWritten(),
+				"duration": time.Since(start).String(),
+				"remote":   r.RemoteAddr,
+			}).Info("request")
+		})
+	}
+}
+
+// NotFound and MethodNotAllowed answer unknown routes in the common error format.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such route")
+}
+
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, r.Method+" is not allowed here")
+}
+
+// MaxBody limits request bodies to limit bytes, or to the limit given for the
+// route path in routes. It is used inside a mounted router, like ValidateRequest,
+// and must come before anything that reads the body.
+func MaxBody(limit int64, routes map[string]int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			n := limit
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				if l, ok := routes[rctx.RoutePath]; ok {
+					n = l
+				}
 			}
-			r.Body = io.NopCloser(strings.NewReader(string(data)))
-			next.ServeHTTP(w, r)
-		} else {
+
+			r.Body = http.MaxBytesReader(w, r.Body, n)
 			next.ServeHTTP(w, r)
-		}
+		})
 	}
-
-	return http.HandlerFunc(fn)
 }
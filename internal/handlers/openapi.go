@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/api/openapi"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"github.com/go-chi/chi"
+)
+
+// ValidateRequest checks the Content-Type and the JSON body of documented
+// operations against the OpenAPI document. It is used inside a mounted router;
+// base is where the document places that router, so aliases share one document.
+// Undocumented routes pass through.
+func ValidateRequest(doc *openapi.Document, base string, logger logging.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			logger := logger.Ctx(r.Context())
+
+			path := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+				path = base + rctx.RoutePath
+			}
+
+			op, ok := doc.Operation(r.Method, path)
+			if !ok || op.RequestBody == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			content, ok := op.RequestBody.Content[mediaType]
+			if err != nil || !ok {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeUnsupportedMediaType,
+					"Content-Type must be "+strings.Join(mediaTypes(op.RequestBody), ", "))
+				return
+			}
+
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				bodyError(w, r, logger, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(b))
+
+			if len(bytes.TrimSpace(b)) == 0 {
+				if op.RequestBody.Required {
+					logger.Printf("%v", http.StatusBadRequest)
+					problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is required")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if mediaType != "application/json" || content.Schema == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var v any
+			dec := json.NewDecoder(bytes.NewReader(b))
+			dec.UseNumber()
+			if err = dec.Decode(&v); err != nil {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
+				return
+			}
+
+			violations := doc.Validate(v, content.Schema)
+			if len(violations) > 0 {
+				list := make([]problem.FieldError, 0, len(violations))
+				for _, v := range violations {
+					list = append(list, problem.FieldError{Field: v.Field, Reason: v.Reason})
+				}
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeValidationFailed, "request body doesn't match the schema", list...)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func mediaTypes(body *openapi.RequestBody) []string {
+
+	list := make([]string, 0, len(body.Content))
+	for mediaType := range body.Content {
+		list = append(list, mediaType)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// OpenAPIHandler serves an OpenAPI document.
+func OpenAPIHandler(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(spec)
+	}
+}
+
+var swaggerUI = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>Gophermart API</title>
+	<link rel="stylesheet" href="{{.}}/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="{{.}}/swagger-ui-bundle.js"></script>
+	<script src="{{.}}/swagger-ui-standalone-preset.js"></script>
+	<script>
+		SwaggerUIBundle({
+			urls: [{url: "/api/v2/openapi.json", name: "v2"}, {url: "/api/openapi.json", name: "v1"}],
+			dom_id: "#swagger-ui",
+			layout: "StandaloneLayout",
+			presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+		});
+	</script>
+</body>
+</html>
+`))
+
+// SwaggerUIHandler serves Swagger UI for the documents. The browser loads the
+// UI itself from assets, the base URL of a swagger-ui-dist copy.
+func SwaggerUIHandler(assets string) http.HandlerFunc {
+
+	assets = strings.TrimSuffix(assets, "/")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var b bytes.Buffer
+		err := swaggerUI.Execute(&b, assets)
+		if err != nil {
+			problem.Internal(w, r, logging.GetLogger().Ctx(r.Context()), err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b.Bytes())
+	}
+}
@@ -5,110 +5,131 @@ import (
 	"errors"
 	"io"
 	"net/http"
-	"sort"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/authjwt"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/pagination"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
 )
 
-func PostOrdersHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+// invalidOrder tells the client which check the order number failed.
+func invalidOrder(err error) string {
+
+	var check *validation.CheckError
+	if errors.As(err, &check) {
+		return "order number " + check.Reason
+	}
+
+	return "order number fails the Luhn check"
+}
+
+func PostOrdersHandler(rep repository.Pool, validators *service.Validators, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	orders := service.NewOrderService(rep.Orders, validators)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		if r.Header.Get("Content-Type") != "text/plain" {
-			logger.Printf("%v", http.StatusBadRequest)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+		logger := logger.Ctx(r.Context())
 
 		b, err := io.ReadAll(r.Body)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			bodyError(w, r, logger, err)
 			return
 		}
 
-		val, err := validation.OrderValid(string(b))
-		if err != nil {
-			logger.Printf("%v", http.StatusBadRequest)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if !val {
-			logger.Printf("%v", http.StatusUnprocessableEntity)
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			return
-		}
+		// the merchant comes in the query, as for batch uploads
+		merchant := r.URL.Query().Get("merchant")
 
-		token := r.Header.Get("Authorization")
-		userID, err := authjwt.ParseJWTWithClaims(token, cfg)
+		accepted, err := orders.Upload(r.Context(), userID(r), merchant, string(b))
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		user, err := rep.Orders.GetUserIDbyOrder(r.Context(), string(b))
-		if err != nil {
-			if errors.Is(err, model.ErrNotExist) {
-				err = rep.Orders.AddOrder(r.Context(), userID, string(b))
-				if err != nil {
-					logger.Error(err)
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				w.WriteHeader(http.StatusAccepted)
+			if errors.Is(err, service.ErrUnknownMerchant) {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeUnknownMerchant, "unknown merchant "+merchant)
+				return
+			} else if errors.Is(err, service.ErrBadOrderNumber) {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedOrderNumber, "order number must consist of digits")
+				return
+			} else if errors.Is(err, service.ErrInvalidOrder) {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber, invalidOrder(err))
+				return
+			} else if errors.Is(err, service.ErrOrderConflict) {
+				logger.Printf("%v", http.StatusConflict)
+				problem.Write(w, r, http.StatusConflict, problem.CodeOrderConflict, "order number was uploaded by another user")
 				return
 			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				problem.Internal(w, r, logger, err)
 				return
 			}
 		}
-		if user == userID {
-			w.WriteHeader(http.StatusOK)
+
+		if accepted {
+			w.WriteHeader(http.StatusAccepted)
 		} else {
-			logger.Printf("%v", http.StatusConflict)
-			w.WriteHeader(http.StatusConflict)
+			w.WriteHeader(http.StatusOK)
 		}
 	}
 }
 
-func GetOrdersHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+func GetOrdersHandler(rep repository.Pool, validators *service.Validators, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	orders := service.NewOrderService(rep.Orders, validators)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		token := r.Header.Get("Authorization")
-		userID, err := authjwt.ParseJWTWithClaims(token, cfg)
-		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		logger := logger.Ctx(r.Context())
+
+		// v2 always pages
+		page := model.Page{}
+		if version(r) == V2 || pagination.Requested(r) {
+			var err error
+			page, err = pagination.FromRequest(r)
+			if err != nil {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeBadQuery, err.Error())
+				return
+			}
 		}
 
-		list, err := rep.Orders.GetOrdersByUserID(r.Context(), userID)
+		list, next, err := orders.List(r.Context(), userID(r), page)
+		if errors.Is(err, model.ErrNotExist) && version(r) == V2 {
+			// v2 answers with an empty page instead of 204
+			err = nil
+		}
 		if err != nil {
 			if errors.Is(err, model.ErrNotExist) {
 				logger.Printf("%v", http.StatusNoContent)
-				http.Error(w, err.Error(), http.StatusNoContent)
+				w.WriteHeader(http.StatusNoContent)
 				return
 			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				problem.Internal(w, r, logger, err)
 				return
 			}
 		}
 
-		sort.Slice(list, func(i, j int) bool {
-			return list[i].UploadedAt.After(list[j].UploadedAt)
-		})
+		cursor := ""
+		if next != nil {
+			cursor, err = pagination.EncodeCursor(next)
+			if err != nil {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+			pagination.SetNext(w, r, cursor, page.Limit)
+		}
+
+		var body any = list
+		if version(r) == V2 {
+			body = ordersPageV2{Orders: toOrdersV2(list), NextCursor: cursor}
+		}
 
-		resp, err := json.Marshal(list)
+		resp, err := json.Marshal(body)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Internal(w, r, logger, err)
 			return
 		}
 
@@ -3,16 +3,18 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
 )
 
 func PingDataBase(rep repository.Pool, logger logging.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := rep.Ping.PingDB()
+		logger := logger.Ctx(r.Context())
+
+		err := rep.Ping.PingDB(r.Context())
 		if err != nil {
-			logger.Error(err)
-			w.WriteHeader(http.StatusInternalServerError)
+			problem.Internal(w, r, logger, err)
 		} else {
 			w.WriteHeader(http.StatusOK)
 		}
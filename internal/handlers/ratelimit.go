@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/ratelimit"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// RateLimit rejects requests over p, counted per key of the request. Requests
+// without a key pass, and so do all requests while the limiter fails: an
+// outage of the limit store must not take the API down with it.
+func RateLimit(l ratelimit.Limiter, p ratelimit.Policy, key func(r *http.Request) string,
+	logger logging.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !p.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			logger := logger.Ctx(r.Context())
+
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			d, err := l.Allow(r.Context(), k, p)
+			if err != nil {
+				logger.Error("rate limit: ", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w, p, d)
+			if !d.Allowed {
+				metrics.RateLimited.WithLabelValues(p.Name).Inc()
+				retry := ceilSeconds(d.RetryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(retry))
+				logger.Printf("%v", http.StatusTooManyRequests)
+				problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited,
+					fmt.Sprintf("too many requests, retry in %d s", retry))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders reports d in the RateLimit headers of the IETF draft.
+// When several policies apply, the one with the fewest requests left is shown.
+func setRateLimitHeaders(w http.ResponseWriter, p ratelimit.Policy, d ratelimit.Decision) {
+
+	h := w.Header()
+	if s := h.Get("RateLimit-Remaining"); s != "" {
+		if remaining, err := strconv.Atoi(s); err == nil && remaining <= d.Remaining {
+			return
+		}
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Limit, ceilSeconds(p.Period)))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ClientIP keys requests by the client address. Behind a proxy, header names
+// where the proxy puts it; the last address in it is the one the proxy saw,
+// the ones before it come from the client and can't be trusted.
+func ClientIP(header string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+
+		if header != "" {
+			if list := r.Header.Values(header); len(list) > 0 {
+				addrs := strings.Split(list[len(list)-1], ",")
+				if ip := strings.TrimSpace(addrs[len(addrs)-1]); ip != "" {
+					return ip
+				}
+			}
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+
+		return host
+	}
+}
+
+// UserID keys requests by the authenticated user, so it goes after Auth.
+func UserID(r *http.Request) string {
+	return userID(r)
+}
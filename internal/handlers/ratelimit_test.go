@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/ratelimit"
+)
+
+// limiterFunc decides without a store.
+type limiterFunc func(key string, p ratelimit.Policy) (ratelimit.Decision, error)
+
+func (f limiterFunc) Allow(ctx context.Context, key string, p ratelimit.Policy) (ratelimit.Decision, error) {
+	return f(key, p)
+}
+
+func decide(d ratelimit.Decision, err error) limiterFunc {
+	return func(key string, p ratelimit.Policy) (ratelimit.Decision, error) {
+		return d, err
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+
+	p := ratelimit.Policy{Name: "test", Limit: 10, Period: 90 * time.Second}
+	tests := []struct {
+		name    string
+		limiter ratelimit.Limiter
+		key     string
+		code    int
+		headers map[string]string
+	}{
+		{name: "allowed", key: "a", code: http.StatusOK,
+			limiter: decide(ratelimit.Decision{Allowed: true, Limit: 10, Remaining: 7, Reset: 20500 * time.Millisecond}, nil),
+			headers: map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "7", "RateLimit-Reset": "21",
+				"RateLimit-Policy": "10;w=90", "Retry-After": ""}},
+		{name: "exhausted", key: "a", code: http.StatusTooManyRequests,
+			limiter: decide(ratelimit.Decision{Limit: 10, Reset: 90 * time.Second, RetryAfter: 8100 * time.Millisecond}, nil),
+			headers: map[string]string{"RateLimit-Limit": "10", "RateLimit-Remaining": "0", "RateLimit-Reset": "90",
+				"RateLimit-Policy": "10;w=90", "Retry-After": "9", "Content-Type": "application/problem+json"}},
+		{name: "no key", code: http.StatusOK,
+			limiter: decide(ratelimit.Decision{}, nil),
+			headers: map[string]string{"RateLimit-Limit": "", "Retry-After": ""}},
+		{name: "limiter fails", key: "a", code: http.StatusOK,
+			limiter: decide(ratelimit.Decision{}, errors.New("store is down")),
+			headers: map[string]string{"RateLimit-Limit": "", "Retry-After": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			key := func(r *http.Request) string { return tt.key }
+			h := RateLimit(tt.limiter, p, key, testLogger())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.code {
+				t.Errorf("code = %d, want %d", w.Code, tt.code)
+			}
+			for name, want := range tt.headers {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// Under several policies the headers show the one with the fewest requests left.
+func TestRateLimitPolicies(t *testing.T) {
+
+	ip := ratelimit.Policy{Name: "ip", Limit: 100, Period: time.Minute}
+	user := ratelimit.Policy{Name: "user", Limit: 5, Period: time.Hour}
+	l := limiterFunc(func(key string, p ratelimit.Policy) (ratelimit.Decision, error) {
+		if p.Name == "ip" {
+			return ratelimit.Decision{Allowed: true, Limit: 100, Remaining: 99, Reset: time.Second}, nil
+		}
+		return ratelimit.Decision{Allowed: true, Limit: 5, Remaining: 2, Reset: time.Hour}, nil
+	})
+	key := func(r *http.Request) string { return "a" }
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, order := range [][]ratelimit.Policy{{ip, user}, {user, ip}} {
+		h := RateLimit(l, order[0], key, testLogger())(RateLimit(l, order[1], key, testLogger())(next))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Header().Get("RateLimit-Remaining") != "2" || w.Header().Get("RateLimit-Policy") != "5;w=3600" {
+			t.Errorf("%s then %s: headers %v, want those of user", order[0].Name, order[1].Name, w.Header())
+		}
+	}
+}
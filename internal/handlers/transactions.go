@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/pagination"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+var transactionTypes = map[string]bool{
+	model.TransactionAccrual:     true,
+	model.TransactionWithdrawal:  true,
+	model.TransactionTransferIn:  true,
+	model.TransactionTransferOut: true,
+	model.TransactionAdjustment:  true,
+	model.TransactionReversal:    true,
+}
+
+func GetTransactionsHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		filter, err := transactionFilter(r)
+		if err != nil {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadQuery, err.Error())
+			return
+		}
+
+		// one extra row tells whether there is a next page
+		limit := filter.Limit
+		filter.Limit++
+
+		list, err := rep.Transactions.GetTransactionsByUserID(r.Context(), userID(r), filter)
+		if errors.Is(err, model.ErrNotExist) && version(r) == V2 {
+			// v2 answers with an empty page instead of 204
+			err = nil
+		}
+		if err != nil {
+			if errors.Is(err, model.ErrNotExist) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		page := model.TransactionPage{Transactions: list}
+		if len(list) > limit {
+			page.Transactions = list[:limit]
+			last := page.Transactions[limit-1]
+			page.NextCursor, err = pagination.EncodeCursor(model.TransactionCursor{
+				ProcessedAt: last.ProcessedAt,
+				Type:        last.Type,
+				Reference:   last.Reference,
+			})
+			if err != nil {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+			pagination.SetNext(w, r, page.NextCursor, limit)
+		}
+
+		var body any = page
+		if version(r) == V2 {
+			body = toTransactionsV2(page)
+		}
+
+		resp, err := json.Marshal(body)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
+
+func transactionFilter(r *http.Request) (model.TransactionFilter, error) {
+
+	filter := model.TransactionFilter{}
+	q := r.URL.Query()
+
+	limit, err := pagination.Limit(r)
+	if err != nil {
+		return filter, err
+	}
+	filter.Limit = limit
+
+	if s := q.Get("type"); s != "" {
+		for _, t := range strings.Split(s, ",") {
+			if !transactionTypes[t] {
+				return filter, errors.New("unknown type: " + t)
+			}
+			filter.Types = append(filter.Types, t)
+		}
+	}
+
+	if s := q.Get("status"); s != "" {
+		filter.Statuses = strings.Split(strings.ToUpper(s), ",")
+	}
+
+	if s := q.Get("from"); s != "" {
+		filter.From, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return filter, errors.New("bad from")
+		}
+	}
+
+	if s := q.Get("to"); s != "" {
+		filter.To, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return filter, errors.New("bad to")
+		}
+	}
+
+	if s := q.Get("cursor"); s != "" {
+		filter.After = &model.TransactionCursor{}
+		err = pagination.DecodeCursor(s, filter.After)
+		if err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
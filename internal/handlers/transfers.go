@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+func PostTransferHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	balance := newBalanceService(rep, cfg)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, r, logger, err)
+			return
+		}
+
+		data, err := decodeTransfer(r, b)
+		if err != nil {
+			badBody(w, r, logger, err)
+			return
+		}
+
+		err = balance.Transfer(r.Context(), userID(r), data.Recipient, data.Sum)
+		if err != nil {
+			if errors.Is(err, service.ErrBadRequest) {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeValidationFailed, "recipient and a positive sum are required", fields(err)...)
+				return
+			} else if errors.Is(err, service.ErrSelfTransfer) {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeValidationFailed, "points can't be transferred to yourself",
+					problem.FieldError{Field: "recipient", Reason: "is the sender"})
+				return
+			} else if errors.Is(err, service.ErrUnknownRecipient) {
+				logger.Printf("%v", http.StatusNotFound)
+				problem.Write(w, r, http.StatusNotFound, problem.CodeUnknownRecipient, "recipient is not registered")
+				return
+			} else if errors.Is(err, service.ErrTransfersDisabled) {
+				logger.Printf("%v", http.StatusServiceUnavailable)
+				problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeTransfersDisabled, "transfers are disabled")
+				return
+			} else if errors.Is(err, model.ErrInsufficientFunds) {
+				logger.Printf("%v", http.StatusPaymentRequired)
+				problem.Write(w, r, http.StatusPaymentRequired, problem.CodeInsufficientPoints, "not enough points on the balance")
+				return
+			} else if errors.Is(err, model.ErrLimitExceeded) {
+				logger.Printf("%v", http.StatusForbidden)
+				problem.Write(w, r, http.StatusForbidden, problem.CodeDailyLimitExceeded, "daily transfer limit exceeded")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func GetTransfersHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		list, err := rep.Transfers.GetTransfersByUserID(r.Context(), userID(r))
+		if errors.Is(err, model.ErrNotExist) && version(r) == V2 {
+			// v2 answers with an empty page instead of 204
+			err = nil
+		}
+		if err != nil {
+			if errors.Is(err, model.ErrNotExist) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		var body any = list
+		if version(r) == V2 {
+			body = transfersPageV2{Transfers: toTransfersV2(list)}
+		}
+
+		resp, err := json.Marshal(body)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
+
+// TransfersSwitchHandler is the admin kill switch for peer-to-peer transfers.
+func TransfersSwitchHandler(rep repository.Pool, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, r, logger, err)
+			return
+		}
+
+		data := model.Switch{}
+		err = json.Unmarshal(b, &data)
+		if err != nil {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
+			return
+		}
+
+		err = rep.Transfers.SetEnabled(r.Context(), data.Enabled)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		logger.Infof("transfers enabled: %v", data.Enabled)
+		w.WriteHeader(http.StatusOK)
+	}
+}
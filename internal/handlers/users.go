@@ -7,109 +7,90 @@ import (
 	"net/http"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/authjwt"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
-	"github.com/segmentio/ksuid"
 )
 
 func RegisterHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	auth := service.NewAuthService(rep.Users, cfg.JWTSecretKey, cfg.TokenTTL)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		if r.Header.Get("Content-Type") != "application/json" {
-			logger.Printf("%v", http.StatusBadRequest)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+		logger := logger.Ctx(r.Context())
 
 		b, err := io.ReadAll(r.Body)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			bodyError(w, r, logger, err)
 			return
 		}
 
 		data := model.UserAuth{}
 		err = json.Unmarshal(b, &data)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
 			return
 		}
 
-		//generate new user ID
-		ID := ksuid.New().String()
-
-		err = rep.Users.AddUserAuthData(r.Context(), data.Login, data.Password, ID)
+		token, err := auth.Register(r.Context(), data.Login, data.Password)
 		if err != nil {
-			if errors.Is(err, model.ErrConflict) {
-				logger.Error(err)
-				w.WriteHeader(http.StatusConflict)
+			if errors.Is(err, service.ErrBadRequest) {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeValidationFailed, "login and password are required", fields(err)...)
+				return
+			} else if errors.Is(err, service.ErrLoginTaken) {
+				logger.Printf("%v", http.StatusConflict)
+				problem.Write(w, r, http.StatusConflict, problem.CodeLoginTaken, "login is already taken")
 				return
 			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				problem.Internal(w, r, logger, err)
 				return
 			}
 		}
 
-		token, err := authjwt.EncodeJWT(ID, cfg.JWTSecretKey)
-		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
 		w.Header().Set("Authorization", token)
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
 func LoginHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	auth := service.NewAuthService(rep.Users, cfg.JWTSecretKey, cfg.TokenTTL)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		if r.Header.Get("Content-Type") != "application/json" {
-			logger.Printf("%v", http.StatusBadRequest)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+		logger := logger.Ctx(r.Context())
 
 		b, err := io.ReadAll(r.Body)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			bodyError(w, r, logger, err)
 			return
 		}
 
 		data := model.UserAuth{}
 		err = json.Unmarshal(b, &data)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
 			return
 		}
 
-		ID, err := rep.Users.GetUserAuthData(r.Context(), data.Login, data.Password)
+		token, err := auth.Login(r.Context(), data.Login, data.Password)
 		if err != nil {
-			if errors.Is(err, model.ErrNotExist) || errors.Is(err, model.ErrWrongPass) {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusUnauthorized)
+			if errors.Is(err, service.ErrBadCredentials) {
+				logger.Printf("%v", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeBadCredentials, "wrong login or password")
 				return
 			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				problem.Internal(w, r, logger, err)
 				return
 			}
 		}
 
-		token, err := authjwt.EncodeJWT(ID, cfg.JWTSecretKey)
-		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
 		w.Header().Set("Authorization", token)
 		w.WriteHeader(http.StatusOK)
 	}
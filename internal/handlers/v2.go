@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// v2 responses carry amounts as decimal strings, so clients never parse floats.
+
+var (
+	errBadAmount = errors.New("amount must be a positive decimal string")
+	amountRe     = regexp.MustCompile(`^[0-9]+(\.[0-9]{1,2})?$`)
+)
+
+func amount(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// parseAmount reads a positive v2 decimal string like "751.50".
+func parseAmount(s string) (float64, error) {
+
+	if !amountRe.MatchString(s) {
+		return 0, errBadAmount
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, errBadAmount
+	}
+
+	return v, nil
+}
+
+type orderV2 struct {
+	Merchant   string    `json:"merchant,omitempty"`
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    string    `json:"accrual,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type ordersPageV2 struct {
+	Orders     []orderV2 `json:"orders"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+func toOrdersV2(list []model.Order) []orderV2 {
+
+	res := make([]orderV2, 0, len(list))
+	for _, o := range list {
+		v := orderV2{
+			Merchant:   o.Merchant,
+			Number:     o.Number,
+			Status:     o.Status,
+			UploadedAt: o.UploadedAt,
+		}
+		if o.Status == "PROCESSED" {
+			v.Accrual = amount(o.Accrual)
+		}
+		res = append(res, v)
+	}
+
+	return res
+}
+
+type balanceV2 struct {
+	Current   string `json:"current"`
+	Withdrawn string `json:"withdrawn"`
+}
+
+func toBalanceV2(b model.Response) balanceV2 {
+	return balanceV2{
+		Current:   amount(b.Current),
+		Withdrawn: amount(b.Withdrawn),
+	}
+}
+
+type writeOffV2 struct {
+	Order string `json:"order"`
+	Sum   string `json:"sum"`
+}
+
+type transferV2 struct {
+	Recipient string `json:"recipient"`
+	Sum       string `json:"sum"`
+}
+
+type withdrawalV2 struct {
+	Order       string    `json:"order"`
+	Sum         string    `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type withdrawalsPageV2 struct {
+	Withdrawals []withdrawalV2 `json:"withdrawals"`
+	NextCursor  string         `json:"next_cursor,omitempty"`
+}
+
+func toWithdrawalsV2(list []model.Withdrawn) []withdrawalV2 {
+
+	res := make([]withdrawalV2, 0, len(list))
+	for _, w := range list {
+		res = append(res, withdrawalV2{
+			Order:       w.Order,
+			Sum:         amount(w.Accrual),
+			ProcessedAt: w.ProcessedAt,
+		})
+	}
+
+	return res
+}
+
+type transferRecordV2 struct {
+	Direction   string    `json:"direction"`
+	User        string    `json:"user"`
+	Sum         string    `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type transfersPageV2 struct {
+	Transfers []transferRecordV2 `json:"transfers"`
+}
+
+func toTransfersV2(list []model.TransferRecord) []transferRecordV2 {
+
+	res := make([]transferRecordV2, 0, len(list))
+	for _, t := range list {
+		res = append(res, transferRecordV2{
+			Direction:   t.Direction,
+			User:        t.User,
+			Sum:         amount(t.Sum),
+			ProcessedAt: t.ProcessedAt,
+		})
+	}
+
+	return res
+}
+
+type transactionV2 struct {
+	Type        string    `json:"type"`
+	Reference   string    `json:"reference"`
+	Status      string    `json:"status"`
+	Sum         string    `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type transactionsPageV2 struct {
+	Transactions []transactionV2 `json:"transactions"`
+	NextCursor   string          `json:"next_cursor,omitempty"`
+}
+
+func toTransactionsV2(page model.TransactionPage) transactionsPageV2 {
+
+	res := transactionsPageV2{
+		Transactions: make([]transactionV2, 0, len(page.Transactions)),
+		NextCursor:   page.NextCursor,
+	}
+	for _, t := range page.Transactions {
+		res.Transactions = append(res.Transactions, transactionV2{
+			Type:        t.Type,
+			Reference:   t.Reference,
+			Status:      t.Status,
+			Sum:         amount(t.Sum),
+			ProcessedAt: t.ProcessedAt,
+		})
+	}
+
+	return res
+}
+
+// decodeWriteOff reads a withdrawal request of either version.
+func decodeWriteOff(r *http.Request, b []byte) (model.WriteOff, error) {
+
+	if version(r) == V1 {
+		data := model.WriteOff{}
+		err := json.Unmarshal(b, &data)
+		return data, err
+	}
+
+	data := writeOffV2{}
+	err := json.Unmarshal(b, &data)
+	if err != nil {
+		return model.WriteOff{}, err
+	}
+
+	sum, err := parseAmount(data.Sum)
+
+	return model.WriteOff{Order: data.Order, Sum: sum}, err
+}
+
+// decodeTransfer reads a transfer request of either version.
+func decodeTransfer(r *http.Request, b []byte) (model.Transfer, error) {
+
+	if version(r) == V1 {
+		data := model.Transfer{}
+		err := json.Unmarshal(b, &data)
+		return data, err
+	}
+
+	data := transferV2{}
+	err := json.Unmarshal(b, &data)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+
+	sum, err := parseAmount(data.Sum)
+
+	return model.Transfer{Recipient: data.Recipient, Sum: sum}, err
+}
+
+// badBody reports a request body that couldn't be decoded.
+func badBody(w http.ResponseWriter, r *http.Request, logger logging.Logger, err error) {
+
+	logger.Printf("%v", http.StatusBadRequest)
+	if errors.Is(err, errBadAmount) {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeValidationFailed, "request body is invalid",
+			problem.FieldError{Field: "sum", Reason: "must be a positive decimal string with up to two decimals"})
+		return
+	}
+
+	problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Version selects the contract a shared handler speaks.
+type Version int
+
+const (
+	// V1 is the original contract of SPECIFICATION.md: float amounts,
+	// bare lists and 204 for empty ones.
+	V1 Version = iota + 1
+	// V2 sends amounts as decimal strings and wraps every list in a page.
+	V2
+)
+
+// V1Deprecated is when v2 was released and v1 became deprecated.
+var V1Deprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+type versionKey struct{}
+
+// APIVersion tells the handlers below which contract to use.
+func APIVersion(v Version) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, v)))
+		})
+	}
+}
+
+func version(r *http.Request) Version {
+
+	v, ok := r.Context().Value(versionKey{}).(Version)
+	if !ok {
+		return V1
+	}
+
+	return v
+}
+
+// Deprecated marks responses with the Deprecation (RFC 9745) and Sunset (RFC 8594)
+// headers and links the same route of the successor version. A zero sunset is omitted.
+func Deprecated(since, sunset time.Time, successor string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(since.Unix(), 10))
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+
+			rest := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+				rest = rctx.RoutePath
+			}
+			w.Header().Add("Link", "<"+successor+strings.TrimSuffix(rest, "/")+">; rel=\"successor-version\"")
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"github.com/go-chi/chi"
+)
+
+// webhookEvents tells the events a webhook may subscribe to, and whether
+// they belong to a merchant: only those may go to the webhook of a merchant.
+var webhookEvents = map[string]bool{
+	model.EventOrderProcessed:    true,
+	model.EventOrderInvalid:      true,
+	model.EventWithdrawalCreated: false,
+}
+
+// AddWebhookHandler registers an endpoint. The signing secret is returned only once, in this response.
+// A webhook of a merchant receives the order events of that merchant only.
+func AddWebhookHandler(rep repository.Pool, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			bodyError(w, r, logger, err)
+			return
+		}
+
+		data := model.Webhook{}
+		err = json.Unmarshal(b, &data)
+		if err != nil {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeMalformedBody, "request body is not valid JSON")
+			return
+		}
+
+		u, err := url.Parse(data.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			logger.Printf("%v", http.StatusUnprocessableEntity)
+			problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeValidationFailed, "webhook is invalid",
+				problem.FieldError{Field: "url", Reason: "must be an absolute http or https URL"})
+			return
+		}
+		if len(data.Events) < 1 {
+			logger.Printf("%v", http.StatusUnprocessableEntity)
+			problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeValidationFailed, "webhook is invalid",
+				problem.FieldError{Field: "events", Reason: "is required"})
+			return
+		}
+		for _, event := range data.Events {
+			ofMerchant, ok := webhookEvents[event]
+			if !ok {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeValidationFailed, "webhook is invalid",
+					problem.FieldError{Field: "events", Reason: "unknown event " + event})
+				return
+			}
+			if data.Merchant != "" && !ofMerchant {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeValidationFailed, "webhook is invalid",
+					problem.FieldError{Field: "events", Reason: event + " doesn't belong to a merchant"})
+				return
+			}
+		}
+		if data.Merchant != "" {
+			_, err = rep.Merchants.GetMerchant(r.Context(), data.Merchant)
+			if errors.Is(err, model.ErrNotExist) {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeValidationFailed, "webhook is invalid",
+					problem.FieldError{Field: "merchant", Reason: "unknown merchant " + data.Merchant})
+				return
+			} else if err != nil {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		hook, err := rep.Webhooks.AddWebhook(r.Context(), data.Merchant, data.URL, hex.EncodeToString(secret), data.Events)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		resp, err := json.Marshal(hook)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(resp)
+	}
+}
+
+func GetWebhooksHandler(rep repository.Pool, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		list, err := rep.Webhooks.GetWebhooks(r.Context())
+		if err != nil {
+			if errors.Is(err, model.ErrNotExist) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		resp, err := json.Marshal(list)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
+
+func DeleteWebhookHandler(rep repository.Pool, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		ID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadQuery, "id must be a number")
+			return
+		}
+
+		err = rep.Webhooks.DeleteWebhook(r.Context(), ID)
+		if err != nil {
+			if errors.Is(err, model.ErrNotExist) {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such id")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func GetDeliveriesHandler(rep repository.Pool, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		list, err := rep.Webhooks.GetDeliveries(r.Context(), r.URL.Query().Get("status"))
+		if err != nil {
+			if errors.Is(err, model.ErrNotExist) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		resp, err := json.Marshal(list)
+		if err != nil {
+			problem.Internal(w, r, logger, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(resp)
+	}
+}
+
+func RedeliverHandler(rep repository.Pool, logger logging.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		logger := logger.Ctx(r.Context())
+
+		ID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			logger.Printf("%v", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadQuery, "id must be a number")
+			return
+		}
+
+		err = rep.Webhooks.Redeliver(r.Context(), ID)
+		if err != nil {
+			if errors.Is(err, model.ErrNotExist) {
+				problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such id")
+				return
+			} else {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -3,148 +3,115 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
-	"sort"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/authjwt"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/pagination"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/problem"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
-	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
 )
 
 func PostWithdrawHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
 
-		if r.Header.Get("Content-Type") != "application/json" {
-			logger.Printf("%v", http.StatusBadRequest)
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	balance := newBalanceService(rep, cfg)
 
-		b, err := io.ReadAll(r.Body)
-		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	return func(w http.ResponseWriter, r *http.Request) {
 
-		data := model.WriteOff{}
-		err = json.Unmarshal(b, &data)
-		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+		logger := logger.Ctx(r.Context())
 
-		val, err := validation.OrderValid(data.Order)
+		b, err := io.ReadAll(r.Body)
 		if err != nil {
-			logger.Printf("%v", http.StatusUnprocessableEntity)
-			w.WriteHeader(http.StatusUnprocessableEntity)
-			return
-		}
-		if !val {
-			logger.Printf("%v", http.StatusUnprocessableEntity)
-			w.WriteHeader(http.StatusUnprocessableEntity)
+			bodyError(w, r, logger, err)
 			return
 		}
 
-		token := r.Header.Get("Authorization")
-		userID, err := authjwt.ParseJWTWithClaims(token, cfg)
+		data, err := decodeWriteOff(r, b)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			badBody(w, r, logger, err)
 			return
 		}
 
-		list, err := rep.Orders.GetOrdersByUserID(r.Context(), userID)
+		err = balance.Withdraw(r.Context(), userID(r), data.Order, data.Sum)
 		if err != nil {
-			if errors.Is(err, model.ErrNotExist) {
-				list = append(list, model.Order{
-					Accrual: 0.0,
-				})
-			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+			if errors.Is(err, service.ErrBadRequest) {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeValidationFailed, "sum must be positive", fields(err)...)
+				return
+			} else if errors.Is(err, service.ErrInvalidOrder) {
+				logger.Printf("%v", http.StatusUnprocessableEntity)
+				problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidOrderNumber, "order number fails the Luhn check")
+				return
+			} else if errors.Is(err, model.ErrInsufficientFunds) {
+				logger.Printf("%v", http.StatusPaymentRequired)
+				problem.Write(w, r, http.StatusPaymentRequired, problem.CodeInsufficientPoints, "not enough points on the balance")
 				return
-			}
-		}
-
-		current := 0.0
-		for _, order := range list {
-			current += order.Accrual
-		}
-
-		wList, err := rep.Withdrawn.GetWithdrawnOrdersByUserID(r.Context(), userID)
-		if err != nil {
-			if errors.Is(err, model.ErrNotExist) {
-				wList = append(wList, model.Withdrawn{
-					Accrual: 0.0,
-				})
 			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				problem.Internal(w, r, logger, err)
 				return
 			}
 		}
 
-		withdrawn := 0.0
-		for _, order := range wList {
-			withdrawn += order.Accrual
-		}
-
-		balance := current - withdrawn
-		if balance < data.Sum {
-			logger.Printf("%v", http.StatusPaymentRequired)
-			w.WriteHeader(http.StatusPaymentRequired)
-			return
-		}
-
-		err = rep.Withdrawn.AddWithdrawnOrder(r.Context(), userID, data.Order, fmt.Sprintf("%g", data.Sum))
-		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
 func GetWithdrawalsHandler(rep repository.Pool, cfg config.Config, logger logging.Logger) http.HandlerFunc {
+
+	balance := newBalanceService(rep, cfg)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		token := r.Header.Get("Authorization")
-		userID, err := authjwt.ParseJWTWithClaims(token, cfg)
-		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		logger := logger.Ctx(r.Context())
+
+		// v2 always pages
+		page := model.Page{}
+		if version(r) == V2 || pagination.Requested(r) {
+			var err error
+			page, err = pagination.FromRequest(r)
+			if err != nil {
+				logger.Printf("%v", http.StatusBadRequest)
+				problem.Write(w, r, http.StatusBadRequest, problem.CodeBadQuery, err.Error())
+				return
+			}
 		}
 
-		list, err := rep.Withdrawn.GetWithdrawnOrdersByUserID(r.Context(), userID)
+		list, next, err := balance.Withdrawals(r.Context(), userID(r), page)
+		if errors.Is(err, model.ErrNotExist) && version(r) == V2 {
+			// v2 answers with an empty page instead of 204
+			err = nil
+		}
 		if err != nil {
 			if errors.Is(err, model.ErrNotExist) {
-				http.Error(w, err.Error(), http.StatusNoContent)
+				w.WriteHeader(http.StatusNoContent)
 				return
 			} else {
-				logger.Error(err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				problem.Internal(w, r, logger, err)
 				return
 			}
 		}
 
-		sort.Slice(list, func(i, j int) bool {
-			return list[i].ProcessedAt.After(list[j].ProcessedAt)
-		})
+		cursor := ""
+		if next != nil {
+			cursor, err = pagination.EncodeCursor(next)
+			if err != nil {
+				problem.Internal(w, r, logger, err)
+				return
+			}
+			pagination.SetNext(w, r, cursor, page.Limit)
+		}
+
+		var body any = list
+		if version(r) == V2 {
+			body = withdrawalsPageV2{Withdrawals: toWithdrawalsV2(list), NextCursor: cursor}
+		}
 
-		resp, err := json.Marshal(list)
+		resp, err := json.Marshal(body)
 		if err != nil {
-			logger.Error(err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			problem.Internal(w, r, logger, err)
 			return
 		}
 
@@ -0,0 +1,180 @@
+// Package health reports whether the service is alive and ready to take
+// traffic, and what it depends on is in a usable state.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFailing  = "failing"
+)
+
+// checkTimeout bounds every check, so a hung dependency can't hang the probe.
+const checkTimeout = 2 * time.Second
+
+var (
+	shuttingDown atomic.Bool
+	heartbeat    atomic.Int64
+)
+
+// ShutDown makes the service report not ready from now on.
+func ShutDown() {
+	shuttingDown.Store(true)
+}
+
+// Beat records that the scanner is alive.
+func Beat() {
+	heartbeat.Store(time.Now().UnixNano())
+}
+
+func lastBeat() time.Time {
+
+	ns := heartbeat.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ns)
+}
+
+type Check struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type Report struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// Ready reports not ready when a check fails. A degraded check, like an
+// unreachable accrual system, leaves the service ready but is reported.
+func (r Report) Ready() bool {
+	return r.Status != StatusFailing
+}
+
+type Checker struct {
+	rep    repository.Pool
+	cfg    config.Config
+	client *http.Client
+}
+
+func NewChecker(rep repository.Pool, cfg config.Config) *Checker {
+	return &Checker{
+		rep:    rep,
+		cfg:    cfg,
+		client: &http.Client{Timeout: checkTimeout},
+	}
+}
+
+// Readiness runs every check.
+func (c *Checker) Readiness(ctx context.Context) Report {
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: map[string]Check{
+			"shutdown": c.shutdown(),
+			"database": c.database(ctx),
+			"schema":   c.schema(ctx),
+			"accrual":  c.accrual(ctx),
+			"scanner":  c.scanner(),
+		},
+	}
+
+	for _, check := range report.Checks {
+		if check.Status == StatusFailing {
+			report.Status = StatusFailing
+			break
+		}
+		if check.Status == StatusDegraded {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+func (c *Checker) shutdown() Check {
+
+	if shuttingDown.Load() {
+		return Check{Status: StatusFailing, Detail: "shutting down"}
+	}
+
+	return Check{Status: StatusOK}
+}
+
+func (c *Checker) database(ctx context.Context) Check {
+
+	err := c.rep.Ping.PingDB(ctx)
+	if err != nil {
+		return Check{Status: StatusFailing, Detail: err.Error()}
+	}
+
+	return Check{Status: StatusOK}
+}
+
+func (c *Checker) schema(ctx context.Context) Check {
+
+	version, err := c.rep.Ping.CheckSchema(ctx)
+	if err != nil {
+		return Check{Status: StatusFailing, Detail: err.Error()}
+	}
+
+	return Check{Status: StatusOK, Detail: fmt.Sprintf("schema version %d", version)}
+}
+
+// accrual only degrades the service: orders are still accepted and
+// scanned once the accrual system is back.
+func (c *Checker) accrual(ctx context.Context) Check {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.AccrualSystemAddress, nil)
+	if err != nil {
+		return Check{Status: StatusDegraded, Detail: err.Error()}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Check{Status: StatusDegraded, Detail: err.Error()}
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return Check{Status: StatusDegraded, Detail: resp.Status}
+	}
+
+	return Check{Status: StatusOK}
+}
+
+// scanner is stale when it missed a few ticks in a row. The scanner beats
+// per order too, so a long scan isn't stale unless one request hangs.
+func (c *Checker) scanner() Check {
+
+	interval := c.cfg.ScanInterval
+	if c.cfg.AccrualCallbackSecret != "" {
+		interval = c.cfg.ReconcileInterval
+	}
+
+	last := lastBeat()
+	if last.IsZero() {
+		return Check{Status: StatusFailing, Detail: "scanner has not started"}
+	}
+
+	age := time.Since(last)
+	if age > 3*interval+model.TimeOut {
+		return Check{Status: StatusFailing, Detail: fmt.Sprintf("last scan %s ago", age.Round(time.Millisecond))}
+	}
+
+	return Check{Status: StatusOK, Detail: fmt.Sprintf("last scan %s ago", age.Round(time.Millisecond))}
+}
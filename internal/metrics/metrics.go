@@ -0,0 +1,146 @@
+// Package metrics keeps the Prometheus metrics of the service. They are
+// exposed by Handler on the admin listener, apart from the public API.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gophermart"
+
+var (
+	// Registry holds every metric of the service.
+	Registry = prometheus.NewRegistry()
+
+	// Pools reports the stats of the database connection pools.
+	Pools = newPoolCollector()
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	ScannerBacklog = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scanner_backlog_orders",
+		Help:      "Orders waiting for a final accrual status at the last scan.",
+	})
+
+	ScannerPolls = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scanner_polls_total",
+		Help:      "Requests the scanner sent to the accrual system.",
+	})
+
+	AccrualResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "accrual_responses_total",
+		Help:      "Responses of the accrual system by status code; \"error\" when the request failed.",
+	}, []string{"code"})
+
+	OrderProcessing = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "order_processing_seconds",
+		Help:      "Time from an order upload to its PROCESSED status.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 3600, 21600, 86400},
+	})
+
+	PointsAccrued = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_accrued_total",
+		Help:      "Points accrued to users for processed orders.",
+	})
+
+	PointsWithdrawn = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "points_withdrawn_total",
+		Help:      "Points withdrawn by users.",
+	})
+
+	Registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Registered users.",
+	})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by a rate limit policy.",
+	}, []string{"policy"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Pools,
+		HTTPRequests,
+		HTTPDuration,
+		ScannerBacklog,
+		ScannerPolls,
+		AccrualResponses,
+		OrderProcessing,
+		PointsAccrued,
+		PointsWithdrawn,
+		Registrations,
+		RateLimited,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts requests by the chi route pattern, so /orders/{id}
+// is a single series however many ids are requested.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := prometheus.Labels{"route": route, "method": r.Method, "status": strconv.Itoa(status)}
+		HTTPRequests.With(labels).Inc()
+		HTTPDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// AccrualResponse counts a response of the accrual system.
+func AccrualResponse(code int) {
+	AccrualResponses.WithLabelValues(strconv.Itoa(code)).Inc()
+}
+
+// Processed records an order that became PROCESSED.
+func Processed(uploaded time.Time, accrual float64) {
+	OrderProcessing.Observe(time.Since(uploaded).Seconds())
+	PointsAccrued.Add(accrual)
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolCollector reports pgxpool stats of every repository pool, labelled by
+// the repository name.
+type PoolCollector struct {
+	mu    sync.Mutex
+	pools map[string]*pgxpool.Pool
+
+	acquired     *prometheus.Desc
+	idle         *prometheus.Desc
+	constructing *prometheus.Desc
+	total        *prometheus.Desc
+	max          *prometheus.Desc
+	acquires     *prometheus.Desc
+	acquireTime  *prometheus.Desc
+	empty        *prometheus.Desc
+	canceled     *prometheus.Desc
+}
+
+func newPoolCollector() *PoolCollector {
+
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pgxpool", name), help, []string{"pool"}, nil)
+	}
+
+	return &PoolCollector{
+		pools:        make(map[string]*pgxpool.Pool),
+		acquired:     desc("acquired_conns", "Connections currently in use."),
+		idle:         desc("idle_conns", "Idle connections."),
+		constructing: desc("constructing_conns", "Connections being established."),
+		total:        desc("total_conns", "All connections of the pool."),
+		max:          desc("max_conns", "Maximum size of the pool."),
+		acquires:     desc("acquires_total", "Successful acquires from the pool."),
+		acquireTime:  desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		empty:        desc("empty_acquires_total", "Acquires that waited because the pool was empty."),
+		canceled:     desc("canceled_acquires_total", "Acquires canceled by their context."),
+	}
+}
+
+// Add reports the pool under name, replacing a previous pool of that name.
+func (c *PoolCollector) Add(name string, pool *pgxpool.Pool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pools[name] = pool
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.constructing
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquires
+	ch <- c.acquireTime
+	ch <- c.empty
+	ch <- c.canceled
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, pool := range c.pools {
+		s := pool.Stat()
+		ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(s.AcquiredConns()), name)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns()), name)
+		ch <- prometheus.MustNewConstMetric(c.constructing, prometheus.GaugeValue, float64(s.ConstructingConns()), name)
+		ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns()), name)
+		ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(s.MaxConns()), name)
+		ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(s.AcquireCount()), name)
+		ch <- prometheus.MustNewConstMetric(c.acquireTime, prometheus.CounterValue, s.AcquireDuration().Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(c.empty, prometheus.CounterValue, float64(s.EmptyAcquireCount()), name)
+		ch <- prometheus.MustNewConstMetric(c.canceled, prometheus.CounterValue, float64(s.CanceledAcquireCount()), name)
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"strconv"
 	"time"
 )
 
@@ -10,6 +11,12 @@ var (
 	ErrNotExist  = errors.New("not exist")
 	Err409       = errors.New("too many requests")
 	ErrWrongPass = errors.New("wrong password")
+
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrLimitExceeded     = errors.New("daily limit exceeded")
+	ErrSelfTransfer      = errors.New("transfer to self")
+	ErrTransfersDisabled = errors.New("transfers are disabled")
+	ErrBadStatus         = errors.New("unknown status")
 )
 
 const TimeOut = time.Second * 10
@@ -20,6 +27,7 @@ type UserAuth struct {
 }
 
 type Order struct {
+	Merchant   string    `json:"merchant,omitempty"`
 	Number     string    `json:"number"`
 	Status     string    `json:"status"`
 	Accrual    float64   `json:"accrual,omitempty"`
@@ -42,8 +50,192 @@ type WriteOff struct {
 	Sum   float64 `json:"sum"`
 }
 
+// ResponseForScanner is a result of the accrual system. Merchant is empty
+// for orders without one; the accrual system of a merchant doesn't send it,
+// the scanner and the callback route set it.
 type ResponseForScanner struct {
-	Order   string  `json:"order"`
-	Status  string  `json:"status"`
-	Accrual float64 `json:"accrual,omitempty"`
+	Merchant string  `json:"merchant,omitempty"`
+	Order    string  `json:"order"`
+	Status   string  `json:"status"`
+	Accrual  float64 `json:"accrual,omitempty"`
+}
+
+type Transfer struct {
+	Recipient string  `json:"recipient"`
+	Sum       float64 `json:"sum"`
+}
+
+type TransferRecord struct {
+	Direction   string    `json:"direction"`
+	User        string    `json:"user"`
+	Sum         float64   `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type Switch struct {
+	Enabled bool `json:"enabled"`
+}
+
+const (
+	TransactionAccrual     = "accrual"
+	TransactionWithdrawal  = "withdrawal"
+	TransactionTransferIn  = "transfer_in"
+	TransactionTransferOut = "transfer_out"
+	TransactionAdjustment  = "adjustment"
+	TransactionReversal    = "reversal"
+)
+
+// Adjustment is an admin correction of a balance: a signed sum and a reference explaining it.
+type Adjustment struct {
+	Reference string  `json:"reference"`
+	Sum       float64 `json:"sum"`
+}
+
+type Transaction struct {
+	Type        string    `json:"type"`
+	Reference   string    `json:"reference"`
+	Status      string    `json:"status"`
+	Sum         float64   `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type TransactionCursor struct {
+	ProcessedAt time.Time `json:"t"`
+	Type        string    `json:"k"`
+	Reference   string    `json:"r"`
+}
+
+type TransactionFilter struct {
+	Types    []string
+	Statuses []string
+	From     time.Time
+	To       time.Time
+	After    *TransactionCursor
+	Limit    int
+}
+
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
+
+// Cursor is the keyset of the last row of a page. Orders are unique per
+// merchant, so their cursor carries the merchant too.
+type Cursor struct {
+	Time     time.Time `json:"t"`
+	Merchant string    `json:"m,omitempty"`
+	Key      string    `json:"k"`
+}
+
+// Page selects the rows after the cursor, newest first. A zero Limit doesn't limit them.
+type Page struct {
+	After *Cursor
+	Limit int
+}
+
+// SQLLimit is the value for a "limit $n" placeholder: null for a zero Limit, which is limit all.
+func (p Page) SQLLimit() any {
+
+	if p.Limit < 1 {
+		return nil
+	}
+
+	return p.Limit
+}
+
+// FormatSum renders points for the text sum columns: fixed-point hundredths, never an exponent.
+func FormatSum(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+const (
+	BatchAccepted  = "accepted"
+	BatchUploaded  = "uploaded"
+	BatchConflict  = "conflict"
+	BatchInvalid   = "invalid"
+	BatchBadFormat = "bad_format"
+)
+
+type BatchResult struct {
+	Number string `json:"number"`
+	Status string `json:"status"`
+}
+
+const (
+	EventOrderProcessed    = "order.processed"
+	EventOrderInvalid      = "order.invalid"
+	EventWithdrawalCreated = "withdrawal.created"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook receives the events it subscribes to. A webhook of a merchant
+// receives only the order events of that merchant; one without a merchant,
+// for the operator's own services, receives the events of every user.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	Merchant  string    `json:"merchant,omitempty"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	UserID    string    `json:"user_id"`
+	Data      any       `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Delivery struct {
+	ID        int64     `json:"id"`
+	WebhookID int64     `json:"webhook_id"`
+	URL       string    `json:"-"`
+	Secret    string    `json:"-"`
+	EventID   string    `json:"event_id"`
+	EventType string    `json:"event_type"`
+	Payload   []byte    `json:"-"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Merchant issues order numbers in a namespace of its own. An empty
+// AccrualAddress or Validator means the service defaults.
+type Merchant struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	AccrualAddress string    `json:"accrual_address,omitempty"`
+	Validator      string    `json:"validator,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type MerchantReport struct {
+	Merchant string         `json:"merchant"`
+	Orders   int            `json:"orders"`
+	Users    int            `json:"users"`
+	Statuses map[string]int `json:"statuses"`
+	Accrued  float64        `json:"accrued"`
+}
+
+const (
+	UserEventOrder   = "order"
+	UserEventBalance = "balance"
+)
+
+type UserEvent struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"-"`
+	UserID    string    `json:"-"`
+	Order     string    `json:"number"`
+	Status    string    `json:"status"`
+	Accrual   float64   `json:"accrual,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
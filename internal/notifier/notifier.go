@@ -0,0 +1,139 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/signature"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+const (
+	batchSize = 50
+	// senders deliver a batch in parallel
+	senders     = 10
+	sendTimeout = 10 * time.Second
+	// claimLease outlasts the slowest batch, each sender timing out on every
+	// delivery it takes, twice over for the updates that follow
+	claimLease  = 2 * ((batchSize + senders - 1) / senders) * sendTimeout
+	baseBackoff = 5 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// Loop delivers webhook events from the outbox until ctx is cancelled.
+func Loop(ctx context.Context, rep repository.Pool, cfg config.Config, logger logging.Logger) {
+
+	ticker := time.NewTicker(time.Second)
+	for {
+		select {
+		case <-ticker.C:
+			dispatch(ctx, rep, cfg, logger)
+		case <-ctx.Done():
+			logger.Info("notifier stopped")
+			return
+		}
+	}
+}
+
+func dispatch(ctx context.Context, rep repository.Pool, cfg config.Config, logger logging.Logger) {
+
+	list, err := rep.Webhooks.ClaimDeliveries(ctx, batchSize, claimLease.Seconds())
+	if err != nil {
+		logger.Printf("notifier:%v", err)
+		return
+	}
+
+	deliveries := make(chan model.Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < senders && i < len(list); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range deliveries {
+				deliver(ctx, rep, cfg, logger, d)
+			}
+		}()
+	}
+
+	for _, d := range list {
+		deliveries <- d
+	}
+	close(deliveries)
+	wg.Wait()
+}
+
+// deliver sends d and records the outcome.
+func deliver(ctx context.Context, rep repository.Pool, cfg config.Config, logger logging.Logger, d model.Delivery) {
+
+	err := send(ctx, d)
+	if err == nil {
+		err = rep.Webhooks.MarkDelivered(ctx, d.ID)
+		if err != nil {
+			logger.Printf("notifier:%v", err)
+		}
+		return
+	}
+
+	attempts := d.Attempts + 1
+	dead := attempts >= cfg.WebhookMaxAttempts
+	if dead {
+		logger.Printf("notifier: delivery %d is dead after %d attempts: %v", d.ID, attempts, err)
+	}
+
+	err = rep.Webhooks.MarkFailed(ctx, d.ID, err.Error(), Backoff(attempts).Seconds(), dead)
+	if err != nil {
+		logger.Printf("notifier:%v", err)
+	}
+}
+
+func send(ctx context.Context, d model.Delivery) error {
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", d.EventID)
+	req.Header.Set("X-Webhook-Event", d.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signature.Prefix+signature.Sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Backoff grows exponentially with the number of failed attempts.
+func Backoff(attempts int) time.Duration {
+
+	d := time.Duration(float64(baseBackoff) * math.Pow(2, float64(attempts-1)))
+	if d > maxBackoff || d <= 0 {
+		return maxBackoff
+	}
+
+	return d
+}
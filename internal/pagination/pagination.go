@@ -0,0 +1,106 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+var ErrBadCursor = errors.New("bad cursor")
+
+// EncodeCursor packs the keyset of the last returned row into an opaque token.
+func EncodeCursor(v any) (string, error) {
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func DecodeCursor(cursor string, v any) error {
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ErrBadCursor
+	}
+
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return ErrBadCursor
+	}
+
+	return nil
+}
+
+// Limit reads the "limit" query parameter, falling back to DefaultLimit.
+func Limit(r *http.Request) (int, error) {
+
+	s := r.URL.Query().Get("limit")
+	if s == "" {
+		return DefaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, errors.New("bad limit")
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	return limit, nil
+}
+
+// Requested reports whether the client asked for a paginated response.
+func Requested(r *http.Request) bool {
+
+	q := r.URL.Query()
+
+	return q.Has("limit") || q.Has("cursor")
+}
+
+// SetNext advertises the next page both as a Link header and as a bare cursor.
+func SetNext(w http.ResponseWriter, r *http.Request, cursor string, limit int) {
+
+	u := *r.URL
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("cursor", cursor)
+	u.RawQuery = q.Encode()
+
+	w.Header().Add("Link", "<"+u.RequestURI()+">; rel=\"next\"")
+	w.Header().Set("X-Next-Cursor", cursor)
+}
+
+// FromRequest builds a page from the "limit" and "cursor" query parameters.
+func FromRequest(r *http.Request) (model.Page, error) {
+
+	page := model.Page{}
+
+	limit, err := Limit(r)
+	if err != nil {
+		return page, err
+	}
+	page.Limit = limit
+
+	if s := r.URL.Query().Get("cursor"); s != "" {
+		page.After = &model.Cursor{}
+		err = DecodeCursor(s, page.After)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,96 @@
+// Package problem writes API errors as RFC 7807 application/problem+json.
+// Every problem carries a stable machine-readable code; internal errors are
+// logged and never shown to the client.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+const ContentType = "application/problem+json"
+
+const (
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeMalformedBody        = "malformed_body"
+	CodeMalformedEncoding    = "malformed_encoding"
+	CodeUnsupportedEncoding  = "unsupported_content_encoding"
+	CodeBodyTooLarge         = "request_body_too_large"
+	CodeValidationFailed     = "validation_failed"
+	CodeBadQuery             = "bad_query_parameter"
+	CodeUnauthorized         = "unauthorized"
+	CodeBadCredentials       = "invalid_credentials"
+	CodeLoginTaken           = "login_already_taken"
+	CodeMalformedOrderNumber = "malformed_order_number"
+	CodeInvalidOrderNumber   = "invalid_order_number"
+	CodeOrderConflict        = "order_already_uploaded_by_other_user"
+	CodeInsufficientPoints   = "insufficient_points"
+	CodeDailyLimitExceeded   = "daily_limit_exceeded"
+	CodeUnknownRecipient     = "unknown_recipient"
+	CodeUnknownMerchant      = "unknown_merchant"
+	CodeMerchantExists       = "merchant_already_exists"
+	CodeTransfersDisabled    = "transfers_disabled"
+	CodeAlreadyReversed      = "withdrawal_already_reversed"
+	CodeBatchTooLarge        = "batch_too_large"
+	CodeUnknownStatus        = "unknown_accrual_status"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeRateLimited          = "rate_limited"
+	CodeStreamingUnsupported = "streaming_unsupported"
+	CodeUnavailable          = "service_unavailable"
+	CodeInternal             = "internal_error"
+)
+
+// FieldError points at one invalid field of the request.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Write responds with the problem. Detail is shown to the client as is.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string, fields ...FieldError) {
+
+	p := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Code:      code,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: middleware.GetReqID(r.Context()),
+		Errors:    fields,
+	}
+
+	resp, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(resp)
+}
+
+// Internal logs err and responds with a 500 that doesn't reveal it.
+func Internal(w http.ResponseWriter, r *http.Request, logger logging.Logger, err error) {
+
+	logger.Ctx(r.Context()).Error(err)
+	Write(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+}
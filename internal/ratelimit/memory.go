@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that refilled completely are dropped.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// Memory keeps the buckets in process memory, so every replica limits on its own.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	// now is the clock, tests replace it
+	now func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+		now:     time.Now,
+	}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, p Policy) (Decision, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.swept) > sweepInterval {
+		m.sweep(now)
+	}
+
+	key = p.Name + ":" + key
+	b, ok := m.buckets[key]
+	if !ok {
+		// a new bucket is as good as one that refilled long ago
+		b = &bucket{tokens: float64(p.Limit), updated: now}
+		m.buckets[key] = b
+	}
+
+	tokens, d := take(p, b.tokens, now.Sub(b.updated))
+	b.tokens = tokens
+	b.updated = now
+	b.full = now.Add(d.Reset)
+
+	return d, nil
+}
+
+// sweep drops full buckets: they are no different from missing ones.
+func (m *Memory) sweep(now time.Time) {
+
+	for key, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.swept = now
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Postgres keeps the buckets in a table, so all replicas share them. Time
+// is taken from the database, so clock skew between replicas doesn't matter.
+type Postgres struct {
+	pool *pgxpool.Pool
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+func NewPostgres(pool *pgxpool.Pool) (*Postgres, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+	if _, err := pool.Exec(ctx, `
+	create table if not exists rate_limits (
+		key text primary key,
+		tokens double precision not null,
+		updated_at timestamptz not null,
+		full_at timestamptz not null
+	);
+	create index if not exists rate_limits_full_at on rate_limits (full_at);
+`); err != nil {
+		return nil, err
+	}
+
+	return &Postgres{
+		pool:  pool,
+		swept: time.Now(),
+	}, nil
+}
+
+func (l *Postgres) Allow(ctx context.Context, key string, p Policy) (Decision, error) {
+
+	l.sweep(ctx)
+
+	tx, err := l.pool.Begin(ctx)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	key = p.Name + ":" + key
+	_, err = tx.Exec(ctx, `insert into rate_limits (key, tokens, updated_at, full_at)
+		values ($1, $2, now(), now()) on conflict (key) do nothing`, key, float64(p.Limit))
+	if err != nil {
+		return Decision{}, err
+	}
+
+	var tokens, elapsed float64
+	err = tx.QueryRow(ctx, `select tokens, extract(epoch from now() - updated_at)::float8
+		from rate_limits where key = $1 for update`, key).Scan(&tokens, &elapsed)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	tokens, d := take(p, tokens, seconds(elapsed))
+	_, err = tx.Exec(ctx, `update rate_limits set tokens = $2, updated_at = now(),
+		full_at = now() + $3 * interval '1 second' where key = $1`, key, tokens, d.Reset.Seconds())
+	if err != nil {
+		return Decision{}, err
+	}
+
+	return d, tx.Commit(ctx)
+}
+
+// sweep deletes full buckets now and then. Only one request of a replica
+// pays for it; a failed sweep is retried later.
+func (l *Postgres) sweep(ctx context.Context) {
+
+	l.mu.Lock()
+	if time.Since(l.swept) < sweepInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.swept = time.Now()
+	l.mu.Unlock()
+
+	_, _ = l.pool.Exec(ctx, `delete from rate_limits where full_at < now()`)
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/repotest"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// The time of Postgres is the database's, so the refill is waited for.
+func TestPostgres(t *testing.T) {
+
+	ctx := context.Background()
+	pool, err := pgxpool.Connect(ctx, repotest.Postgres(t))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	l, err := NewPostgres(pool)
+	if err != nil {
+		t.Fatalf("NewPostgres: %v", err)
+	}
+
+	p := Policy{Name: "test", Limit: 2, Period: 400 * time.Millisecond}
+	for i, want := range []bool{true, true, false} {
+		d, err := l.Allow(ctx, "a", p)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if d.Allowed != want || d.Limit != 2 {
+			t.Errorf("request %d: got %+v, want allowed %v", i+1, d, want)
+		}
+		if !d.Allowed && (d.RetryAfter <= 0 || d.RetryAfter > 200*time.Millisecond) {
+			t.Errorf("request %d: retry after %v, want up to 200ms", i+1, d.RetryAfter)
+		}
+	}
+
+	if d, err := l.Allow(ctx, "b", p); err != nil || !d.Allowed || d.Remaining != 1 {
+		t.Errorf("Allow for another key: got %+v, %v, want allowed with 1 left", d, err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if d, err := l.Allow(ctx, "a", p); err != nil || !d.Allowed {
+		t.Errorf("Allow after a refill: got %+v, %v, want allowed", d, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Package ratelimit limits how often a client may call the API with token
+// buckets. A bucket holds up to Policy.Limit tokens and refills at Limit per
+// Period; every request takes a token, and is rejected when there is none.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+)
+
+// Policy is a named limit. Buckets of different policies are separate, even for the same client.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// ParsePolicy parses a limit like "10/1m": 10 requests a minute, with bursts
+// of up to 10. An empty spec returns a zero Policy, which limits nothing.
+func ParsePolicy(name, spec string) (Policy, error) {
+
+	if spec == "" {
+		return Policy{}, nil
+	}
+
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("rate limit must look like 10/1m, got %q", spec)
+	}
+	limit, err := strconv.Atoi(count)
+	if err != nil || limit < 1 {
+		return Policy{}, fmt.Errorf("rate limit count must be a positive number, got %q", count)
+	}
+	p, err := time.ParseDuration(period)
+	if err != nil || p <= 0 {
+		return Policy{}, fmt.Errorf("rate limit period must be a positive duration, got %q", period)
+	}
+
+	return Policy{Name: name, Limit: limit, Period: p}, nil
+}
+
+// Enabled reports whether p limits anything.
+func (p Policy) Enabled() bool {
+	return p.Limit > 0
+}
+
+// rate is the refill in tokens per second.
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Decision is the outcome of a request against a bucket.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, when this one isn't.
+	RetryAfter time.Duration
+}
+
+// Limiter keeps the buckets. Allow takes a token from the bucket of key under p.
+type Limiter interface {
+	Allow(ctx context.Context, key string, p Policy) (Decision, error)
+}
+
+// take refills a bucket that held tokens elapsed ago and takes a token if
+// there is one. It returns the tokens left for the bucket to keep.
+func take(p Policy, tokens float64, elapsed time.Duration) (float64, Decision) {
+
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	rate := p.rate()
+	tokens = math.Min(float64(p.Limit), tokens+elapsed.Seconds()*rate)
+
+	d := Decision{Limit: p.Limit}
+	if tokens >= 1 {
+		tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	d.Remaining = int(tokens)
+	d.Reset = seconds((float64(p.Limit) - tokens) / rate)
+
+	return tokens, d
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
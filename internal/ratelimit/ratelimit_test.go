@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a time tests move by hand.
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func TestParsePolicy(t *testing.T) {
+
+	p, err := ParsePolicy("login", "10/1m")
+	if err != nil || p != (Policy{Name: "login", Limit: 10, Period: time.Minute}) {
+		t.Errorf("ParsePolicy(10/1m): got %+v, %v", p, err)
+	}
+	if p, err := ParsePolicy("login", ""); err != nil || p.Enabled() {
+		t.Errorf("ParsePolicy(\"\"): got %+v, %v, want a disabled policy", p, err)
+	}
+
+	for _, spec := range []string{"10", "0/1m", "-1/1m", "ten/1m", "10/", "10/0s", "10/-1m", "10/minute"} {
+		if _, err := ParsePolicy("login", spec); err == nil {
+			t.Errorf("ParsePolicy(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestTake(t *testing.T) {
+
+	// 3 tokens, one more a second
+	p := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		left    float64
+		want    Decision
+	}{
+		{name: "full", tokens: 3, left: 2,
+			want: Decision{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{name: "last token", tokens: 1, left: 0,
+			want: Decision{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{name: "empty", tokens: 0, left: 0,
+			want: Decision{Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		{name: "half refilled", tokens: 0, elapsed: 500 * time.Millisecond, left: 0.5,
+			want: Decision{Limit: 3, Remaining: 0, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{name: "refilled a token", tokens: 0.5, elapsed: 500 * time.Millisecond, left: 0,
+			want: Decision{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{name: "refill stops at the limit", tokens: 0, elapsed: time.Hour, left: 2,
+			want: Decision{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{name: "clock going back", tokens: 0, elapsed: -time.Hour, left: 0,
+			want: Decision{Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			left, d := take(p, tt.tokens, tt.elapsed)
+			if left != tt.left || d != tt.want {
+				t.Errorf("take(%v, %v) = %v, %+v, want %v, %+v", tt.tokens, tt.elapsed, left, d, tt.left, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+
+	ctx := context.Background()
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := NewMemory()
+	m.now = c.now
+
+	p := Policy{Name: "test", Limit: 3, Period: 3 * time.Second}
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		key       string
+		allowed   bool
+		remaining int
+		retry     time.Duration
+	}{
+		{name: "burst 1", key: "a", allowed: true, remaining: 2},
+		{name: "burst 2", key: "a", allowed: true, remaining: 1},
+		{name: "burst 3", key: "a", allowed: true, remaining: 0},
+		{name: "exhausted", key: "a", retry: time.Second},
+		{name: "other key", key: "b", allowed: true, remaining: 2},
+		{name: "half a token later", advance: 500 * time.Millisecond, key: "a", retry: 500 * time.Millisecond},
+		{name: "a token later", advance: 500 * time.Millisecond, key: "a", allowed: true, remaining: 0},
+		{name: "refilled", advance: time.Minute, key: "a", allowed: true, remaining: 2},
+	}
+	for _, st := range steps {
+		c.t = c.t.Add(st.advance)
+		d, err := m.Allow(ctx, st.key, p)
+		if err != nil {
+			t.Fatalf("%s: Allow: %v", st.name, err)
+		}
+		if d.Allowed != st.allowed || d.Remaining != st.remaining || d.RetryAfter != st.retry || d.Limit != p.Limit {
+			t.Errorf("%s: got %+v, want allowed %v, remaining %d, retry after %v", st.name, d, st.allowed, st.remaining, st.retry)
+		}
+	}
+
+	// policies keep separate buckets for the same key
+	d, err := m.Allow(ctx, "a", Policy{Name: "other", Limit: 1, Period: time.Hour})
+	if err != nil || !d.Allowed {
+		t.Errorf("Allow under another policy: got %+v, %v, want allowed", d, err)
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+
+	ctx := context.Background()
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := NewMemory()
+	m.now = c.now
+	m.swept = c.t
+
+	short := Policy{Name: "short", Limit: 1, Period: time.Second}
+	long := Policy{Name: "long", Limit: 1, Period: time.Hour}
+	for _, p := range []Policy{short, long} {
+		if _, err := m.Allow(ctx, "a", p); err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+	}
+
+	// the next request sweeps the short bucket, full again, but not the long one
+	c.t = c.t.Add(2 * sweepInterval)
+	if _, err := m.Allow(ctx, "b", short); err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if _, ok := m.buckets["short:a"]; ok {
+		t.Error("full bucket short:a was not swept")
+	}
+	if _, ok := m.buckets["long:a"]; !ok {
+		t.Error("bucket long:a was swept before it refilled")
+	}
+}
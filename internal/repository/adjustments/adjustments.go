@@ -0,0 +1,146 @@
+package adjustments
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/events"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/transfers"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(cfg config.Config) (*Repository, error) {
+
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("adjustments", pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+	if _, err := pool.Exec(ctx, `
+	create table if not exists adjustments (
+		user_id varchar(27) not null,
+		kind text not null,
+		reference text not null,
+		amount text not null,
+		processed_time timestamp not null default current_timestamp
+	);
+	create index if not exists adjustments_user_id_processed_time_idx on adjustments (user_id, processed_time);
+	create unique index if not exists adjustments_reversal_idx on adjustments (user_id, reference) where kind = 'reversal';
+`); err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		pool: pool,
+	}, nil
+}
+
+// AddAdjustment credits the user with a positive sum or debits a negative one.
+// A debit is checked under transfers.LockBalance like a withdrawal.
+func (p *Repository) AddAdjustment(ctx context.Context, userID, reference, sum string) error {
+
+	amount, err := strconv.ParseFloat(sum, 64)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	balance, err := transfers.LockBalance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if amount < 0 && balance+amount < 0 {
+		return model.ErrInsufficientFunds
+	}
+
+	_, err = tx.Exec(ctx, `insert into adjustments (user_id, kind, reference, amount) values ($1, $2, $3, $4)`,
+		userID, model.TransactionAdjustment, reference, sum)
+	if err != nil {
+		return err
+	}
+
+	err = events.RecordBalance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ReverseWithdrawal returns the points of the user's withdrawal to the order back to the balance.
+// A withdrawal is reversed at most once.
+func (p *Repository) ReverseWithdrawal(ctx context.Context, userID, order string) error {
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = transfers.LockBalance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	amount, count := 0.0, 0
+	err = tx.QueryRow(ctx, `select coalesce(sum(order_accrual::numeric), 0)::float8, count(*) from withdrawn
+		where user_id = $1 and order_id = $2`, userID, order).
+		Scan(&amount, &count)
+	if err != nil {
+		return err
+	}
+	if count < 1 {
+		return model.ErrNotExist
+	}
+
+	_, err = tx.Exec(ctx, `insert into adjustments (user_id, kind, reference, amount) values ($1, $2, $3, $4)`,
+		userID, model.TransactionReversal, order, model.FormatSum(amount))
+	if err != nil {
+		pgerr, ok := err.(*pgconn.PgError)
+		if ok {
+			if pgerr.Code == "23505" {
+				return model.ErrConflict
+			}
+		}
+
+		return err
+	}
+
+	err = events.RecordBalance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetAdjustmentsBalance returns the net result of adjustments and reversals for the user.
+func (p *Repository) GetAdjustmentsBalance(ctx context.Context, userID string) (float64, error) {
+
+	net := 0.0
+	err := p.pool.QueryRow(ctx, `select coalesce(sum(amount::numeric), 0)::float8 from adjustments where user_id = $1`, userID).
+		Scan(&net)
+	if err != nil {
+		return 0, err
+	}
+
+	return net, nil
+}
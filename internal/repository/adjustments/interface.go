@@ -0,0 +1,11 @@
+package adjustments
+
+import (
+	"context"
+)
+
+type Adjustments interface {
+	AddAdjustment(ctx context.Context, userID, reference, sum string) error
+	ReverseWithdrawal(ctx context.Context, userID, order string) error
+	GetAdjustmentsBalance(ctx context.Context, userID string) (float64, error)
+}
@@ -0,0 +1,193 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const channel = "user_events"
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(cfg config.Config) (*Repository, error) {
+
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("events", pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+	if _, err := pool.Exec(ctx, `
+	create table if not exists user_events (
+		id bigserial primary key,
+		user_id varchar(27) not null,
+		order_id text not null,
+		order_status text not null,
+		order_accrual text not null,
+		created_time timestamp not null default current_timestamp
+	);
+	create index if not exists user_events_user_id_id_idx on user_events (user_id, id);
+	alter table user_events add column if not exists event_type text not null default 'order';
+`); err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		pool: pool,
+	}, nil
+}
+
+// Lock serializes the events of the users until the end of tx. An event ID is
+// taken under the lock, so the IDs of one user's events grow in commit order and
+// a stream resuming after an ID can't miss an event that commits late.
+// The users are locked in order, so transactions locking the same pair don't deadlock.
+func Lock(ctx context.Context, tx pgx.Tx, userIDs ...string) error {
+
+	list := append([]string(nil), userIDs...)
+	sort.Strings(list)
+
+	for _, userID := range list {
+		_, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtext($1), hashtext($2))`, channel, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Record stores an order status change within the caller's transaction and
+// notifies listeners on every replica once the transaction commits.
+func Record(ctx context.Context, tx pgx.Tx, userID, order, status, accrual string) error {
+
+	amount, err := strconv.ParseFloat(accrual, 64)
+	if err != nil {
+		return err
+	}
+
+	return record(ctx, tx, model.UserEvent{
+		Type:    model.UserEventOrder,
+		UserID:  userID,
+		Order:   order,
+		Status:  status,
+		Accrual: amount,
+	})
+}
+
+// RecordBalance stores a change of the user's balance by a withdrawal or a transfer
+// within the caller's transaction, like Record.
+func RecordBalance(ctx context.Context, tx pgx.Tx, userID string) error {
+	return record(ctx, tx, model.UserEvent{Type: model.UserEventBalance, UserID: userID})
+}
+
+func record(ctx context.Context, tx pgx.Tx, event model.UserEvent) error {
+
+	err := Lock(ctx, tx, event.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(ctx, `insert into user_events (event_type, user_id, order_id, order_status, order_accrual)
+		values ($1, $2, $3, $4, $5) returning id, created_time`,
+		event.Type, event.UserID, event.Order, event.Status, model.FormatSum(event.Accrual)).
+		Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(notification{event, event.Type, event.UserID})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `select pg_notify($1, $2)`, channel, string(payload))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// notification carries the fields that are not part of the JSON representation sent to clients.
+type notification struct {
+	model.UserEvent
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+}
+
+func (p *Repository) GetEventsAfter(ctx context.Context, userID string, ID int64) ([]model.UserEvent, error) {
+
+	rows, err := p.pool.Query(ctx, `select id, event_type, order_id, order_status, order_accrual, created_time from user_events
+		where user_id = $1 and id > $2 order by id`, userID, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.UserEvent, 0)
+
+	for rows.Next() {
+
+		var accrual string
+		event := model.UserEvent{UserID: userID}
+
+		err = rows.Scan(&event.ID, &event.Type, &event.Order, &event.Status, &accrual, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		event.Accrual, err = strconv.ParseFloat(accrual, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, event)
+	}
+
+	return list, rows.Err()
+}
+
+// Listen holds a dedicated connection subscribed to the notification channel
+// and calls fn for every event until ctx is cancelled or the connection fails.
+func (p *Repository) Listen(ctx context.Context, fn func(event model.UserEvent)) error {
+
+	c, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Release()
+
+	_, err = c.Exec(ctx, "listen "+channel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := c.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		data := notification{}
+		err = json.Unmarshal([]byte(n.Payload), &data)
+		if err != nil {
+			continue
+		}
+		data.UserEvent.Type, data.UserEvent.UserID = data.Type, data.UserID
+
+		fn(data.UserEvent)
+	}
+}
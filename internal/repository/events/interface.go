@@ -0,0 +1,12 @@
+package events
+
+import (
+	"context"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Events interface {
+	GetEventsAfter(ctx context.Context, userID string, ID int64) ([]model.UserEvent, error)
+	Listen(ctx context.Context, fn func(event model.UserEvent)) error
+}
@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Adjustments struct {
+	s *Store
+}
+
+func NewAdjustments(s *Store) *Adjustments {
+	return &Adjustments{s: s}
+}
+
+func (p *Adjustments) AddAdjustment(ctx context.Context, userID, reference, sum string) error {
+
+	amount, err := strconv.ParseFloat(sum, 64)
+	if err != nil {
+		return err
+	}
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if amount < 0 && p.s.balance(userID)+amount < 0 {
+		return model.ErrInsufficientFunds
+	}
+
+	p.s.adjusted = append(p.s.adjusted, adjustment{
+		user:      userID,
+		kind:      model.TransactionAdjustment,
+		reference: reference,
+		sum:       sum,
+		processed: p.s.now(),
+	})
+	p.s.record(model.UserEvent{Type: model.UserEventBalance, UserID: userID})
+
+	return nil
+}
+
+func (p *Adjustments) ReverseWithdrawal(ctx context.Context, userID, order string) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	amount, found := 0.0, false
+	for _, w := range p.s.withdrawn {
+		if w.user == userID && w.order == order {
+			amount += parseSum(w.sum)
+			found = true
+		}
+	}
+	if !found {
+		return model.ErrNotExist
+	}
+
+	for _, a := range p.s.adjusted {
+		if a.user == userID && a.kind == model.TransactionReversal && a.reference == order {
+			return model.ErrConflict
+		}
+	}
+
+	p.s.adjusted = append(p.s.adjusted, adjustment{
+		user:      userID,
+		kind:      model.TransactionReversal,
+		reference: order,
+		sum:       model.FormatSum(amount),
+		processed: p.s.now(),
+	})
+	p.s.record(model.UserEvent{Type: model.UserEventBalance, UserID: userID})
+
+	return nil
+}
+
+func (p *Adjustments) GetAdjustmentsBalance(ctx context.Context, userID string) (float64, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	net := 0.0
+	for _, a := range p.s.adjusted {
+		if a.user == userID {
+			net += parseSum(a.sum)
+		}
+	}
+
+	return net, nil
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Events struct {
+	s *Store
+}
+
+func NewEvents(s *Store) *Events {
+	return &Events{s: s}
+}
+
+// record must be called with the lock held. The listeners are called under
+// the lock too, so they see the events in ID order, as after a commit.
+func (s *Store) record(event model.UserEvent) {
+
+	event.ID = int64(len(s.events) + 1)
+	event.CreatedAt = s.now()
+	s.events = append(s.events, event)
+
+	for _, fn := range s.listeners {
+		fn(event)
+	}
+}
+
+func (p *Events) GetEventsAfter(ctx context.Context, userID string, ID int64) ([]model.UserEvent, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	list := make([]model.UserEvent, 0)
+	for _, event := range p.s.events {
+		if event.UserID == userID && event.ID > ID {
+			list = append(list, event)
+		}
+	}
+
+	return list, nil
+}
+
+func (p *Events) Listen(ctx context.Context, fn func(event model.UserEvent)) error {
+
+	p.s.mu.Lock()
+	p.s.listener++
+	ID := p.s.listener
+	p.s.listeners[ID] = fn
+	p.s.mu.Unlock()
+
+	<-ctx.Done()
+
+	p.s.mu.Lock()
+	delete(p.s.listeners, ID)
+	p.s.mu.Unlock()
+
+	return ctx.Err()
+}
@@ -0,0 +1,219 @@
+// Package memory implements the repository interfaces in process memory.
+// The semantics follow the PostgreSQL repositories, so the service can run
+// without a database in tests and demos.
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type user struct {
+	hash string
+	ID   string
+}
+
+type order struct {
+	user     string
+	merchant string
+	number   string
+	status   string
+	accrual  string
+	uploaded time.Time
+}
+
+// orderKey makes order numbers unique per merchant.
+type orderKey struct {
+	merchant string
+	number   string
+}
+
+type withdrawal struct {
+	user      string
+	order     string
+	sum       string
+	processed time.Time
+}
+
+type transfer struct {
+	sender    string
+	recipient string
+	sum       string
+	processed time.Time
+}
+
+type adjustment struct {
+	user      string
+	kind      string
+	reference string
+	sum       string
+	processed time.Time
+}
+
+type delivery struct {
+	model.Delivery
+	next time.Time
+}
+
+// Store holds the data of all memory repositories behind one lock, so
+// operations spanning several of them stay atomic as in a transaction.
+type Store struct {
+	mu sync.Mutex
+
+	users     map[string]user
+	merchants map[string]model.Merchant
+	orders    map[orderKey]*order
+	withdrawn []withdrawal
+	transfers []transfer
+	adjusted  []adjustment
+	disabled  bool
+	schema    int
+
+	events    []model.UserEvent
+	listeners map[int]func(event model.UserEvent)
+	listener  int
+
+	webhooks   map[int64]model.Webhook
+	webhookID  int64
+	deliveries []*delivery
+	deliveryID int64
+
+	// clock dates the records, the wall clock when nil
+	clock func() time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:     make(map[string]user),
+		merchants: make(map[string]model.Merchant),
+		orders:    make(map[orderKey]*order),
+		listeners: make(map[int]func(event model.UserEvent)),
+		webhooks:  make(map[int64]model.Webhook),
+	}
+}
+
+// SetClock makes the store date its records by clock, as tests do to
+// cross a day; nil returns it to the wall clock.
+func (s *Store) SetClock(clock func() time.Time) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clock = clock
+}
+
+// now is the time under the lock.
+func (s *Store) now() time.Time {
+	if s.clock != nil {
+		return s.clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func parseSum(s string) float64 {
+
+	num, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+
+	return num
+}
+
+// before reports whether the row keyed by k comes after the cursor in newest-first order.
+func before(k model.Cursor, c *model.Cursor) bool {
+
+	if c == nil {
+		return true
+	}
+
+	return older(k, *c)
+}
+
+// older reports whether a comes after b in newest-first order: by time, then merchant, then key.
+func older(a, b model.Cursor) bool {
+
+	if !a.Time.Equal(b.Time) {
+		return a.Time.Before(b.Time)
+	}
+	if a.Merchant != b.Merchant {
+		return a.Merchant < b.Merchant
+	}
+
+	return a.Key < b.Key
+}
+
+func newestFirst[T any](list []T, key func(T) model.Cursor) {
+	sort.Slice(list, func(i, j int) bool {
+		return older(key(list[j]), key(list[i]))
+	})
+}
+
+// balance must be called with the lock held.
+func (s *Store) balance(userID string) float64 {
+
+	current := 0.0
+	for _, o := range s.orders {
+		if o.user == userID {
+			current += parseSum(o.accrual)
+		}
+	}
+	for _, w := range s.withdrawn {
+		if w.user == userID {
+			current -= parseSum(w.sum)
+		}
+	}
+	for _, t := range s.transfers {
+		if t.sender == userID {
+			current -= parseSum(t.sum)
+		}
+		if t.recipient == userID {
+			current += parseSum(t.sum)
+		}
+	}
+	for _, a := range s.adjusted {
+		if a.user == userID {
+			current += parseSum(a.sum)
+		}
+	}
+
+	return current
+}
+
+type Ping struct {
+	s *Store
+}
+
+func NewPing(s *Store) *Ping {
+	return &Ping{s: s}
+}
+
+func (p *Ping) PingDB(ctx context.Context) error {
+	return nil
+}
+
+// CheckSchema has nothing to check: the store is built by this release.
+func (p *Ping) CheckSchema(ctx context.Context) (int, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	return p.s.schema, nil
+}
+
+func (p *Ping) SetSchemaVersion(ctx context.Context, version int) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if version > p.s.schema {
+		p.s.schema = version
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Merchants struct {
+	s *Store
+}
+
+func NewMerchants(s *Store) *Merchants {
+	return &Merchants{s: s}
+}
+
+func (p *Merchants) AddMerchant(ctx context.Context, merchant model.Merchant) (model.Merchant, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if _, ok := p.s.merchants[merchant.ID]; ok {
+		return model.Merchant{}, model.ErrConflict
+	}
+
+	merchant.CreatedAt = p.s.now()
+	p.s.merchants[merchant.ID] = merchant
+
+	return merchant, nil
+}
+
+func (p *Merchants) UpdateMerchant(ctx context.Context, merchant model.Merchant) (model.Merchant, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	prev, ok := p.s.merchants[merchant.ID]
+	if !ok {
+		return model.Merchant{}, model.ErrNotExist
+	}
+
+	merchant.CreatedAt = prev.CreatedAt
+	p.s.merchants[merchant.ID] = merchant
+
+	return merchant, nil
+}
+
+func (p *Merchants) GetMerchant(ctx context.Context, ID string) (model.Merchant, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	merchant, ok := p.s.merchants[ID]
+	if !ok {
+		return model.Merchant{}, model.ErrNotExist
+	}
+
+	return merchant, nil
+}
+
+func (p *Merchants) GetMerchants(ctx context.Context) ([]model.Merchant, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	list := make([]model.Merchant, 0, len(p.s.merchants))
+	for _, merchant := range p.s.merchants {
+		list = append(list, merchant)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Merchants) GetReport(ctx context.Context, ID string, from, to time.Time) (model.MerchantReport, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if _, ok := p.s.merchants[ID]; !ok {
+		return model.MerchantReport{}, model.ErrNotExist
+	}
+
+	report := model.MerchantReport{
+		Merchant: ID,
+		Statuses: make(map[string]int),
+	}
+	users := make(map[string]bool)
+	for _, o := range p.s.orders {
+		if o.merchant != ID || (!from.IsZero() && o.uploaded.Before(from)) || (!to.IsZero() && !o.uploaded.Before(to)) {
+			continue
+		}
+		report.Statuses[o.status]++
+		report.Orders++
+		report.Accrued += parseSum(o.accrual)
+		users[o.user] = true
+	}
+	report.Users = len(users)
+
+	return report, nil
+}
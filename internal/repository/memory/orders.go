@@ -0,0 +1,193 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Orders struct {
+	s *Store
+}
+
+func NewOrders(s *Store) *Orders {
+	return &Orders{s: s}
+}
+
+func (p *Orders) GetUserIDbyOrder(ctx context.Context, merchant, number string) (string, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	o, ok := p.s.orders[orderKey{merchant, number}]
+	if !ok {
+		return "", model.ErrNotExist
+	}
+
+	return o.user, nil
+}
+
+func (p *Orders) AddOrder(ctx context.Context, userID, merchant, number string) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	key := orderKey{merchant, number}
+	if _, ok := p.s.orders[key]; ok {
+		return model.ErrConflict
+	}
+
+	p.s.orders[key] = &order{
+		user:     userID,
+		merchant: merchant,
+		number:   number,
+		status:   "NEW",
+		accrual:  "0.0",
+		uploaded: p.s.now(),
+	}
+
+	return nil
+}
+
+func (p *Orders) AddOrders(ctx context.Context, userID, merchant string, numbers []string) (map[string]bool, map[string]string, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	inserted := make(map[string]bool)
+	owners := make(map[string]string)
+	uploaded := p.s.now()
+
+	for _, number := range numbers {
+		key := orderKey{merchant, number}
+		if o, ok := p.s.orders[key]; ok {
+			owners[number] = o.user
+			continue
+		}
+		p.s.orders[key] = &order{
+			user:     userID,
+			merchant: merchant,
+			number:   number,
+			status:   "NEW",
+			accrual:  "0.0",
+			uploaded: uploaded,
+		}
+		inserted[number] = true
+		owners[number] = userID
+	}
+
+	return inserted, owners, nil
+}
+
+func toOrder(o *order) model.Order {
+
+	res := model.Order{
+		Merchant:   o.merchant,
+		Number:     o.number,
+		Status:     o.status,
+		UploadedAt: o.uploaded,
+	}
+	if o.accrual != "0.0" {
+		res.Accrual = parseSum(o.accrual)
+	}
+
+	return res
+}
+
+func (p *Orders) GetOrdersByUserID(ctx context.Context, userID string) ([]model.Order, error) {
+	return p.GetOrdersPageByUserID(ctx, userID, model.Page{})
+}
+
+func (p *Orders) GetAccrualSum(ctx context.Context, userID string) (float64, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	sum := 0.0
+	for _, o := range p.s.orders {
+		if o.user == userID {
+			sum += parseSum(o.accrual)
+		}
+	}
+
+	return sum, nil
+}
+
+func (p *Orders) GetOrdersPageByUserID(ctx context.Context, userID string, page model.Page) ([]model.Order, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	list := make([]model.Order, 0)
+	for _, o := range p.s.orders {
+		if o.user == userID && before(model.Cursor{Time: o.uploaded, Merchant: o.merchant, Key: o.number}, page.After) {
+			list = append(list, toOrder(o))
+		}
+	}
+
+	newestFirst(list, func(o model.Order) model.Cursor {
+		return model.Cursor{Time: o.UploadedAt, Merchant: o.Merchant, Key: o.Number}
+	})
+	if page.Limit > 0 && len(list) > page.Limit {
+		list = list[:page.Limit]
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Orders) GetOrdersForScanner() ([]model.Order, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	list := make([]model.Order, 0)
+	for _, o := range p.s.orders {
+		if o.status == "NEW" || o.status == "REGISTERED" || o.status == "PROCESSING" {
+			list = append(list, model.Order{Merchant: o.merchant, Number: o.number})
+		}
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Orders) UpdateOrderData(ctx context.Context, merchant, status, accrual, number string) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	o, ok := p.s.orders[orderKey{merchant, number}]
+	if !ok {
+		return model.ErrNotExist
+	}
+
+	// INVALID and PROCESSED are final
+	if o.status == "INVALID" || o.status == "PROCESSED" || (o.status == status && o.accrual == accrual) {
+		return nil
+	}
+
+	prev := o.status
+	o.status, o.accrual = status, accrual
+	p.s.record(model.UserEvent{Type: model.UserEventOrder, UserID: o.user, Order: number, Status: status, Accrual: parseSum(accrual)})
+
+	if prev != status {
+		data := model.ResponseForScanner{Merchant: merchant, Order: number, Status: status, Accrual: parseSum(accrual)}
+		switch status {
+		case "PROCESSED":
+			p.s.enqueue(model.EventOrderProcessed, merchant, o.user, data)
+			metrics.Processed(o.uploaded, parseSum(accrual))
+		case "INVALID":
+			p.s.enqueue(model.EventOrderInvalid, merchant, o.user, data)
+		}
+	}
+
+	return nil
+}
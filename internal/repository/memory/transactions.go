@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Transactions struct {
+	s *Store
+}
+
+func NewTransactions(s *Store) *Transactions {
+	return &Transactions{s: s}
+}
+
+func contains(list []string, v string) bool {
+
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Transactions) GetTransactionsByUserID(ctx context.Context, userID string, filter model.TransactionFilter) ([]model.Transaction, error) {
+
+	p.s.mu.Lock()
+	feed := make([]model.Transaction, 0)
+	for _, o := range p.s.orders {
+		if o.user == userID {
+			feed = append(feed, model.Transaction{Type: model.TransactionAccrual, Reference: o.number, Status: o.status, Sum: parseSum(o.accrual), ProcessedAt: o.uploaded})
+		}
+	}
+	for _, w := range p.s.withdrawn {
+		if w.user == userID {
+			feed = append(feed, model.Transaction{Type: model.TransactionWithdrawal, Reference: w.order, Status: "PROCESSED", Sum: parseSum(w.sum), ProcessedAt: w.processed})
+		}
+	}
+	for _, t := range p.s.transfers {
+		if t.sender == userID {
+			feed = append(feed, model.Transaction{Type: model.TransactionTransferOut, Reference: p.s.login(t.recipient), Status: "PROCESSED", Sum: parseSum(t.sum), ProcessedAt: t.processed})
+		}
+		if t.recipient == userID {
+			feed = append(feed, model.Transaction{Type: model.TransactionTransferIn, Reference: p.s.login(t.sender), Status: "PROCESSED", Sum: parseSum(t.sum), ProcessedAt: t.processed})
+		}
+	}
+	for _, a := range p.s.adjusted {
+		if a.user == userID {
+			feed = append(feed, model.Transaction{Type: a.kind, Reference: a.reference, Status: "PROCESSED", Sum: parseSum(a.sum), ProcessedAt: a.processed})
+		}
+	}
+	p.s.mu.Unlock()
+
+	list := make([]model.Transaction, 0)
+	for _, tr := range feed {
+		if !contains(filter.Types, tr.Type) || !contains(filter.Statuses, tr.Status) {
+			continue
+		}
+		if !filter.From.IsZero() && tr.ProcessedAt.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !tr.ProcessedAt.Before(filter.To) {
+			continue
+		}
+		if c := filter.After; c != nil && !less(tr, *c) {
+			continue
+		}
+		list = append(list, tr)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return less(list[j], model.TransactionCursor{ProcessedAt: list[i].ProcessedAt, Type: list[i].Type, Reference: list[i].Reference})
+	})
+	if filter.Limit > 0 && len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+// less compares (time, type, reference) tuples like the SQL row comparison.
+func less(tr model.Transaction, c model.TransactionCursor) bool {
+
+	if !tr.ProcessedAt.Equal(c.ProcessedAt) {
+		return tr.ProcessedAt.Before(c.ProcessedAt)
+	}
+	if tr.Type != c.Type {
+		return tr.Type < c.Type
+	}
+
+	return tr.Reference < c.Reference
+}
@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Transfers struct {
+	s *Store
+}
+
+func NewTransfers(s *Store) *Transfers {
+	return &Transfers{s: s}
+}
+
+func (p *Transfers) AddTransfer(ctx context.Context, senderID, recipientID, sum string, dailyLimit float64) error {
+
+	amount, err := strconv.ParseFloat(sum, 64)
+	if err != nil {
+		return err
+	}
+
+	if senderID == recipientID {
+		return model.ErrSelfTransfer
+	}
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if p.s.disabled {
+		return model.ErrTransfersDisabled
+	}
+	if p.s.balance(senderID) < amount {
+		return model.ErrInsufficientFunds
+	}
+
+	y, m, d := p.s.now().Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	today := 0.0
+	for _, t := range p.s.transfers {
+		if t.sender == senderID && !t.processed.Before(day) {
+			today += parseSum(t.sum)
+		}
+	}
+	if dailyLimit > 0 && today+amount > dailyLimit {
+		return model.ErrLimitExceeded
+	}
+
+	p.s.transfers = append(p.s.transfers, transfer{
+		sender:    senderID,
+		recipient: recipientID,
+		sum:       sum,
+		processed: p.s.now(),
+	})
+	p.s.record(model.UserEvent{Type: model.UserEventBalance, UserID: senderID})
+	p.s.record(model.UserEvent{Type: model.UserEventBalance, UserID: recipientID})
+
+	return nil
+}
+
+func (p *Transfers) GetTransfersByUserID(ctx context.Context, userID string) ([]model.TransferRecord, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	list := make([]model.TransferRecord, 0)
+	for _, t := range p.s.transfers {
+		if t.sender == userID {
+			list = append(list, model.TransferRecord{Direction: "out", User: p.s.login(t.recipient), Sum: parseSum(t.sum), ProcessedAt: t.processed})
+		}
+		if t.recipient == userID {
+			list = append(list, model.TransferRecord{Direction: "in", User: p.s.login(t.sender), Sum: parseSum(t.sum), ProcessedAt: t.processed})
+		}
+	}
+
+	newestFirst(list, func(t model.TransferRecord) model.Cursor { return model.Cursor{Time: t.ProcessedAt, Key: t.User} })
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Transfers) GetTransfersBalance(ctx context.Context, userID string) (float64, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	net := 0.0
+	for _, t := range p.s.transfers {
+		if t.sender == userID {
+			net -= parseSum(t.sum)
+		}
+		if t.recipient == userID {
+			net += parseSum(t.sum)
+		}
+	}
+
+	return net, nil
+}
+
+func (p *Transfers) Enabled(ctx context.Context) (bool, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	return !p.s.disabled, nil
+}
+
+func (p *Transfers) SetEnabled(ctx context.Context, enabled bool) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	p.s.disabled = !enabled
+
+	return nil
+}
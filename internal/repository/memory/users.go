@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/crypt"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/tracing"
+)
+
+type Users struct {
+	s *Store
+}
+
+func NewUsers(s *Store) *Users {
+	return &Users{s: s}
+}
+
+func (p *Users) AddUserAuthData(ctx context.Context, login, pass, ID string) error {
+
+	_, span := tracing.Start(ctx, "bcrypt hash")
+	hash, err := crypt.HashPassword(pass)
+	span.End()
+	if err != nil {
+		return err
+	}
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if _, ok := p.s.users[login]; ok {
+		return model.ErrConflict
+	}
+	for _, u := range p.s.users {
+		if u.ID == ID {
+			return model.ErrConflict
+		}
+	}
+
+	p.s.users[login] = user{hash: hash, ID: ID}
+	metrics.Registrations.Inc()
+
+	return nil
+}
+
+func (p *Users) GetUserAuthData(ctx context.Context, login, pass string) (string, error) {
+
+	p.s.mu.Lock()
+	u, ok := p.s.users[login]
+	p.s.mu.Unlock()
+	if !ok {
+		return "", model.ErrNotExist
+	}
+
+	_, span := tracing.Start(ctx, "bcrypt compare")
+	ok = crypt.CheckPasswordHash(pass, u.hash)
+	span.End()
+	if !ok {
+		return "", model.ErrWrongPass
+	}
+
+	return u.ID, nil
+}
+
+func (p *Users) GetUserIDByLogin(ctx context.Context, login string) (string, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	u, ok := p.s.users[login]
+	if !ok {
+		return "", model.ErrNotExist
+	}
+
+	return u.ID, nil
+}
+
+// login must be called with the lock held.
+func (s *Store) login(userID string) string {
+
+	for login, u := range s.users {
+		if u.ID == userID {
+			return login
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,220 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/segmentio/ksuid"
+)
+
+type Webhooks struct {
+	s *Store
+}
+
+func NewWebhooks(s *Store) *Webhooks {
+	return &Webhooks{s: s}
+}
+
+// enqueue must be called with the lock held. Like webhooks.Enqueue, it
+// delivers to the webhooks of merchant and to those of no merchant.
+func (s *Store) enqueue(eventType, merchant, userID string, data any) {
+
+	event := model.Event{
+		ID:        ksuid.New().String(),
+		Type:      eventType,
+		UserID:    userID,
+		Data:      data,
+		CreatedAt: s.now(),
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	for _, hook := range s.webhooks {
+		if !contains(hook.Events, eventType) || (hook.Merchant != "" && hook.Merchant != merchant) {
+			continue
+		}
+		s.deliveryID++
+		s.deliveries = append(s.deliveries, &delivery{
+			Delivery: model.Delivery{
+				ID:        s.deliveryID,
+				WebhookID: hook.ID,
+				EventID:   event.ID,
+				EventType: eventType,
+				Payload:   payload,
+				Status:    model.DeliveryPending,
+				CreatedAt: event.CreatedAt,
+			},
+			next: event.CreatedAt,
+		})
+	}
+}
+
+func (p *Webhooks) AddWebhook(ctx context.Context, merchant, url, secret string, events []string) (model.Webhook, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	p.s.webhookID++
+	hook := model.Webhook{
+		ID:        p.s.webhookID,
+		Merchant:  merchant,
+		URL:       url,
+		Secret:    secret,
+		Events:    events,
+		CreatedAt: p.s.now(),
+	}
+	p.s.webhooks[hook.ID] = hook
+
+	return hook, nil
+}
+
+func (p *Webhooks) GetWebhooks(ctx context.Context) ([]model.Webhook, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	list := make([]model.Webhook, 0)
+	for ID := int64(1); ID <= p.s.webhookID; ID++ {
+		if hook, ok := p.s.webhooks[ID]; ok {
+			hook.Secret = ""
+			list = append(list, hook)
+		}
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Webhooks) DeleteWebhook(ctx context.Context, ID int64) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if _, ok := p.s.webhooks[ID]; !ok {
+		return model.ErrNotExist
+	}
+	delete(p.s.webhooks, ID)
+
+	kept := p.s.deliveries[:0]
+	for _, d := range p.s.deliveries {
+		if d.WebhookID != ID {
+			kept = append(kept, d)
+		}
+	}
+	p.s.deliveries = kept
+
+	return nil
+}
+
+func (p *Webhooks) ClaimDeliveries(ctx context.Context, limit int, lease float64) ([]model.Delivery, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	t := p.s.now()
+	list := make([]model.Delivery, 0)
+	for _, d := range p.s.deliveries {
+		if len(list) >= limit {
+			break
+		}
+		if d.Status != model.DeliveryPending || d.next.After(t) {
+			continue
+		}
+		d.next = t.Add(time.Duration(lease * float64(time.Second)))
+		claimed := d.Delivery
+		claimed.URL = p.s.webhooks[d.WebhookID].URL
+		claimed.Secret = p.s.webhooks[d.WebhookID].Secret
+		list = append(list, claimed)
+	}
+
+	return list, nil
+}
+
+func (p *Webhooks) find(ID int64) *delivery {
+
+	for _, d := range p.s.deliveries {
+		if d.ID == ID {
+			return d
+		}
+	}
+
+	return nil
+}
+
+func (p *Webhooks) MarkDelivered(ctx context.Context, ID int64) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if d := p.find(ID); d != nil {
+		d.Status = model.DeliveryDelivered
+		d.Attempts++
+		d.LastError = ""
+	}
+
+	return nil
+}
+
+func (p *Webhooks) MarkFailed(ctx context.Context, ID int64, reason string, retryIn float64, dead bool) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if d := p.find(ID); d != nil {
+		d.Status = model.DeliveryPending
+		if dead {
+			d.Status = model.DeliveryDead
+		}
+		d.Attempts++
+		d.LastError = reason
+		d.next = p.s.now().Add(time.Duration(retryIn * float64(time.Second)))
+	}
+
+	return nil
+}
+
+func (p *Webhooks) GetDeliveries(ctx context.Context, status string) ([]model.Delivery, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	list := make([]model.Delivery, 0)
+	for i := len(p.s.deliveries) - 1; i >= 0; i-- {
+		d := p.s.deliveries[i].Delivery
+		if status == "" || d.Status == status {
+			d.Payload = nil
+			list = append(list, d)
+		}
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Webhooks) Redeliver(ctx context.Context, ID int64) error {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	d := p.find(ID)
+	if d == nil {
+		return model.ErrNotExist
+	}
+	d.Status = model.DeliveryPending
+	d.Attempts = 0
+	d.LastError = ""
+	d.next = p.s.now()
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Withdrawn struct {
+	s *Store
+}
+
+func NewWithdrawn(s *Store) *Withdrawn {
+	return &Withdrawn{s: s}
+}
+
+func (p *Withdrawn) GetWithdrawnOrdersByUserID(ctx context.Context, userID string) ([]model.Withdrawn, error) {
+	return p.GetWithdrawnPageByUserID(ctx, userID, model.Page{})
+}
+
+func (p *Withdrawn) GetWithdrawnPageByUserID(ctx context.Context, userID string, page model.Page) ([]model.Withdrawn, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	list := make([]model.Withdrawn, 0)
+	for _, w := range p.s.withdrawn {
+		if w.user == userID && before(model.Cursor{Time: w.processed, Key: w.order}, page.After) {
+			res := model.Withdrawn{
+				Order:       w.order,
+				ProcessedAt: w.processed,
+			}
+			if w.sum != "0.0" {
+				res.Accrual = parseSum(w.sum)
+			}
+			list = append(list, res)
+		}
+	}
+
+	newestFirst(list, func(w model.Withdrawn) model.Cursor { return model.Cursor{Time: w.ProcessedAt, Key: w.Order} })
+	if page.Limit > 0 && len(list) > page.Limit {
+		list = list[:page.Limit]
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Withdrawn) GetWithdrawnSum(ctx context.Context, userID string) (float64, error) {
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	sum := 0.0
+	for _, w := range p.s.withdrawn {
+		if w.user == userID {
+			sum += parseSum(w.sum)
+		}
+	}
+
+	return sum, nil
+}
+
+func (p *Withdrawn) AddWithdrawnOrder(ctx context.Context, userID, order, sum string) error {
+
+	amount, err := strconv.ParseFloat(sum, 64)
+	if err != nil {
+		return err
+	}
+
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+
+	if p.s.balance(userID) < amount {
+		return model.ErrInsufficientFunds
+	}
+
+	p.s.withdrawn = append(p.s.withdrawn, withdrawal{
+		user:      userID,
+		order:     order,
+		sum:       sum,
+		processed: p.s.now(),
+	})
+	p.s.record(model.UserEvent{Type: model.UserEventBalance, UserID: userID})
+	p.s.enqueue(model.EventWithdrawalCreated, "", userID, model.WriteOff{Order: order, Sum: amount})
+	metrics.PointsWithdrawn.Add(amount)
+
+	return nil
+}
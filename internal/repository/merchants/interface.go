@@ -0,0 +1,17 @@
+package merchants
+
+import (
+	"context"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Merchants interface {
+	AddMerchant(ctx context.Context, merchant model.Merchant) (model.Merchant, error)
+	UpdateMerchant(ctx context.Context, merchant model.Merchant) (model.Merchant, error)
+	GetMerchant(ctx context.Context, ID string) (model.Merchant, error)
+	GetMerchants(ctx context.Context) ([]model.Merchant, error)
+	// GetReport sums up the orders of the merchant uploaded within [from, to); zero times don't bound.
+	GetReport(ctx context.Context, ID string, from, to time.Time) (model.MerchantReport, error)
+}
@@ -0,0 +1,178 @@
+package merchants
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(cfg config.Config) (*Repository, error) {
+
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("merchants", pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+	if _, err := pool.Exec(ctx, `
+	create table if not exists merchants (
+		id text primary key,
+		name text not null,
+		accrual_address text not null default '',
+		validator text not null default '',
+		created_time timestamp not null default current_timestamp
+	);
+`); err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		pool: pool,
+	}, nil
+}
+
+func (p *Repository) AddMerchant(ctx context.Context, merchant model.Merchant) (model.Merchant, error) {
+
+	err := p.pool.QueryRow(ctx, `insert into merchants (id, name, accrual_address, validator) values ($1, $2, $3, $4)
+		returning created_time`, merchant.ID, merchant.Name, merchant.AccrualAddress, merchant.Validator).
+		Scan(&merchant.CreatedAt)
+	if err != nil {
+		pgerr, ok := err.(*pgconn.PgError)
+		if ok {
+			if pgerr.Code == "23505" {
+				return model.Merchant{}, model.ErrConflict
+			}
+		}
+
+		return model.Merchant{}, err
+	}
+
+	return merchant, nil
+}
+
+func (p *Repository) UpdateMerchant(ctx context.Context, merchant model.Merchant) (model.Merchant, error) {
+
+	err := p.pool.QueryRow(ctx, `update merchants set name = $2, accrual_address = $3, validator = $4 where id = $1
+		returning created_time`, merchant.ID, merchant.Name, merchant.AccrualAddress, merchant.Validator).
+		Scan(&merchant.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Merchant{}, model.ErrNotExist
+		}
+		return model.Merchant{}, err
+	}
+
+	return merchant, nil
+}
+
+func (p *Repository) GetMerchant(ctx context.Context, ID string) (model.Merchant, error) {
+
+	merchant := model.Merchant{}
+	err := p.pool.QueryRow(ctx, `select id, name, accrual_address, validator, created_time from merchants where id = $1`, ID).
+		Scan(&merchant.ID, &merchant.Name, &merchant.AccrualAddress, &merchant.Validator, &merchant.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.Merchant{}, model.ErrNotExist
+		}
+		return model.Merchant{}, err
+	}
+
+	return merchant, nil
+}
+
+func (p *Repository) GetMerchants(ctx context.Context) ([]model.Merchant, error) {
+
+	rows, err := p.pool.Query(ctx, `select id, name, accrual_address, validator, created_time from merchants order by id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Merchant, 0)
+	for rows.Next() {
+		var merchant model.Merchant
+		err = rows.Scan(&merchant.ID, &merchant.Name, &merchant.AccrualAddress, &merchant.Validator, &merchant.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, merchant)
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Repository) GetReport(ctx context.Context, ID string, from, to time.Time) (model.MerchantReport, error) {
+
+	_, err := p.GetMerchant(ctx, ID)
+	if err != nil {
+		return model.MerchantReport{}, err
+	}
+
+	args := []any{ID}
+	where := "merchant_id = $1"
+	if !from.IsZero() {
+		args = append(args, from.UTC())
+		where += " and upload_time >= $" + strconv.Itoa(len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to.UTC())
+		where += " and upload_time < $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := p.pool.Query(ctx, `select order_status, count(*), coalesce(sum(order_accrual::numeric), 0)::float8
+		from orders where `+where+` group by order_status`, args...)
+	if err != nil {
+		return model.MerchantReport{}, err
+	}
+	defer rows.Close()
+
+	report := model.MerchantReport{
+		Merchant: ID,
+		Statuses: make(map[string]int),
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		var accrued float64
+		err = rows.Scan(&status, &count, &accrued)
+		if err != nil {
+			return model.MerchantReport{}, err
+		}
+		report.Statuses[status] = count
+		report.Orders += count
+		report.Accrued += accrued
+	}
+	if rows.Err() != nil {
+		return model.MerchantReport{}, rows.Err()
+	}
+
+	// users are counted apart: one can have orders in several statuses
+	err = p.pool.QueryRow(ctx, `select count(distinct user_id) from orders where `+where, args...).Scan(&report.Users)
+	if err != nil {
+		return model.MerchantReport{}, err
+	}
+
+	return report, nil
+}
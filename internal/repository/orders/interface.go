@@ -6,10 +6,14 @@ import (
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
 )
 
+// Orders are unique per merchant; the empty merchant ID is the namespace of orders without one.
 type Orders interface {
-	GetUserIDbyOrder(ctx context.Context, order string) (string, error)
-	AddOrder(ctx context.Context, userID, order string) error
+	GetUserIDbyOrder(ctx context.Context, merchant, order string) (string, error)
+	AddOrder(ctx context.Context, userID, merchant, order string) error
+	AddOrders(ctx context.Context, userID, merchant string, orders []string) (map[string]bool, map[string]string, error)
 	GetOrdersByUserID(ctx context.Context, userID string) ([]model.Order, error)
+	GetOrdersPageByUserID(ctx context.Context, userID string, page model.Page) ([]model.Order, error)
+	GetAccrualSum(ctx context.Context, userID string) (float64, error)
 	GetOrdersForScanner() ([]model.Order, error)
-	UpdateOrderData(ctx context.Context, status, accrual, order string) error
+	UpdateOrderData(ctx context.Context, merchant, status, accrual, order string) error
 }
@@ -2,12 +2,18 @@ package orders
 
 import (
 	"context"
+	"errors"
 	"strconv"
+	"time"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/events"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/webhooks"
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -17,17 +23,28 @@ type Repository struct {
 
 func NewRepository(cfg config.Config) (*Repository, error) {
 
-	pool := conn.NewConnection(cfg)
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("orders", pool)
+
 	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
 	defer cancel()
 	if _, err := pool.Exec(ctx, `	
 	create table if not exists orders (	    
 		user_id varchar(27) not null,
-		order_id text unique not null,
+		merchant_id text not null default '',
+		order_id text not null,
 		order_status text not null default 'NEW',
 	    order_accrual text not null default '0.0',
 		upload_time timestamp not null default current_timestamp
-	);	
+	);
+	create index if not exists orders_user_id_upload_time_idx on orders (user_id, upload_time);
+	-- order numbers used to be unique across merchants
+	alter table orders add column if not exists merchant_id text not null default '';
+	alter table orders drop constraint if exists orders_order_id_key;
+	create unique index if not exists orders_merchant_id_order_id_idx on orders (merchant_id, order_id);
 `); err != nil {
 		return nil, err
 	}
@@ -37,10 +54,10 @@ func NewRepository(cfg config.Config) (*Repository, error) {
 	}, nil
 }
 
-func (p *Repository) GetUserIDbyOrder(ctx context.Context, order string) (string, error) {
+func (p *Repository) GetUserIDbyOrder(ctx context.Context, merchant, order string) (string, error) {
 
 	user, ord := "", ""
-	err := p.pool.QueryRow(ctx, `select user_id, order_id from orders where order_id = $1`, order).
+	err := p.pool.QueryRow(ctx, `select user_id, order_id from orders where merchant_id = $1 and order_id = $2`, merchant, order).
 		Scan(&user, &ord)
 	if err != nil {
 		return "", model.ErrNotExist
@@ -49,9 +66,9 @@ func (p *Repository) GetUserIDbyOrder(ctx context.Context, order string) (string
 	return user, nil
 }
 
-func (p *Repository) AddOrder(ctx context.Context, userID, order string) error {
+func (p *Repository) AddOrder(ctx context.Context, userID, merchant, order string) error {
 
-	_, err := p.pool.Exec(ctx, `insert into orders (user_id, order_id) values ($1, $2)`, userID, order)
+	_, err := p.pool.Exec(ctx, `insert into orders (user_id, merchant_id, order_id) values ($1, $2, $3)`, userID, merchant, order)
 	if err != nil {
 		pgerr, ok := err.(*pgconn.PgError)
 		if ok {
@@ -66,21 +83,122 @@ func (p *Repository) AddOrder(ctx context.Context, userID, order string) error {
 	return nil
 }
 
+// AddOrders inserts the batch with a single statement. It returns the set of
+// orders inserted by this call and the owners of all orders from the batch.
+func (p *Repository) AddOrders(ctx context.Context, userID, merchant string, orders []string) (map[string]bool, map[string]string, error) {
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `insert into orders (user_id, merchant_id, order_id) select $1, $2, unnest($3::text[])
+		on conflict (merchant_id, order_id) do nothing returning order_id`, userID, merchant, orders)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inserted := make(map[string]bool)
+	for rows.Next() {
+		var order string
+		err = rows.Scan(&order)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		inserted[order] = true
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, nil, rows.Err()
+	}
+
+	rows, err = tx.Query(ctx, `select order_id, user_id from orders where merchant_id = $1 and order_id = any($2)`, merchant, orders)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owners := make(map[string]string)
+	for rows.Next() {
+		var order, user string
+		err = rows.Scan(&order, &user)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		owners[order] = user
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return nil, nil, rows.Err()
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inserted, owners, nil
+}
+
 func (p *Repository) GetOrdersByUserID(ctx context.Context, userID string) ([]model.Order, error) {
 
-	rows, err := p.pool.Query(ctx, `select user_id, order_id, order_status, order_accrual, upload_time from orders where user_id=$1`, userID)
+	rows, err := p.pool.Query(ctx, `select merchant_id, order_id, order_status, order_accrual, upload_time from orders where user_id=$1
+		order by upload_time desc, merchant_id desc, order_id desc`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOrders(rows)
+}
+
+// GetAccrualSum returns the total accrued to the user's orders.
+func (p *Repository) GetAccrualSum(ctx context.Context, userID string) (float64, error) {
+
+	sum := 0.0
+	err := p.pool.QueryRow(ctx, `select coalesce(sum(order_accrual::numeric), 0)::float8 from orders where user_id = $1`, userID).
+		Scan(&sum)
+	if err != nil {
+		return 0, err
+	}
+
+	return sum, nil
+}
+
+// GetOrdersPageByUserID returns up to page.Limit orders uploaded before the page cursor, newest first;
+// a zero limit returns them all.
+func (p *Repository) GetOrdersPageByUserID(ctx context.Context, userID string, page model.Page) ([]model.Order, error) {
+
+	var rows pgx.Rows
+	var err error
+	if page.After == nil {
+		rows, err = p.pool.Query(ctx, `select merchant_id, order_id, order_status, order_accrual, upload_time from orders where user_id=$1
+			order by upload_time desc, merchant_id desc, order_id desc limit $2`, userID, page.SQLLimit())
+	} else {
+		rows, err = p.pool.Query(ctx, `select merchant_id, order_id, order_status, order_accrual, upload_time from orders where user_id=$1
+			and (upload_time, merchant_id, order_id) < ($2, $3, $4) order by upload_time desc, merchant_id desc, order_id desc limit $5`,
+			userID, page.After.Time, page.After.Merchant, page.After.Key, page.SQLLimit())
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	return scanOrders(rows)
+}
+
+func scanOrders(rows pgx.Rows) ([]model.Order, error) {
+
+	defer rows.Close()
+
 	list := make([]model.Order, 0)
 
 	for rows.Next() {
 
-		var user, accrual string
+		var accrual string
 		var order model.Order
 
-		err = rows.Scan(&user, &order.Number, &order.Status, &accrual, &order.UploadedAt)
+		err := rows.Scan(&order.Merchant, &order.Number, &order.Status, &accrual, &order.UploadedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -109,7 +227,7 @@ func (p *Repository) GetOrdersForScanner() ([]model.Order, error) {
 	defer cancel()
 
 	rows, err := p.pool.Query(ctx,
-		`select order_id, order_status from orders where order_status=$1 or order_status=$2 or order_status=$3 `,
+		`select merchant_id, order_id from orders where order_status=$1 or order_status=$2 or order_status=$3 `,
 		"NEW", "REGISTERED", "PROCESSING")
 	if err != nil {
 		return nil, err
@@ -118,10 +236,9 @@ func (p *Repository) GetOrdersForScanner() ([]model.Order, error) {
 	list := make([]model.Order, 0)
 
 	for rows.Next() {
-		var status string
 		var order model.Order
 
-		err = rows.Scan(&order.Number, &status)
+		err = rows.Scan(&order.Merchant, &order.Number)
 		if err != nil {
 			return nil, err
 		}
@@ -136,12 +253,84 @@ func (p *Repository) GetOrdersForScanner() ([]model.Order, error) {
 	return list, nil
 }
 
-func (p *Repository) UpdateOrderData(ctx context.Context, status, accrual, order string) error {
+// UpdateOrderData stores the accrual result. A change of the row is recorded
+// as a user event, and a transition to a final status is written to the
+// webhook outbox, both in the same transaction.
+func (p *Repository) UpdateOrderData(ctx context.Context, merchant, status, accrual, order string) error {
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	user, prev, prevAccrual, uploaded := "", "", "", time.Time{}
+	err = tx.QueryRow(ctx, `select user_id, order_status, order_accrual, upload_time from orders
+		where merchant_id = $1 and order_id = $2 for update`, merchant, order).
+		Scan(&user, &prev, &prevAccrual, &uploaded)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return model.ErrNotExist
+		}
+		return err
+	}
+
+	// INVALID and PROCESSED are final
+	if prev == "INVALID" || prev == "PROCESSED" {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `update orders set order_status = $1 , order_accrual = $2 where merchant_id = $3 and order_id = $4`,
+		status, accrual, merchant, order)
+	if err != nil {
+		return err
+	}
+
+	if prev != status || prevAccrual != accrual {
+		err = events.Record(ctx, tx, user, order, status, accrual)
+		if err != nil {
+			return err
+		}
+	}
+
+	if prev != status {
+		event := ""
+		switch status {
+		case "PROCESSED":
+			event = model.EventOrderProcessed
+		case "INVALID":
+			event = model.EventOrderInvalid
+		}
+		if event != "" {
+			err = webhooks.Enqueue(ctx, tx, event, merchant, user, model.ResponseForScanner{
+				Merchant: merchant,
+				Order:    order,
+				Status:   status,
+				Accrual:  parseAccrual(accrual),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
 
-	_, err := p.pool.Exec(ctx, `update orders set order_status = $1 , order_accrual = $2 where order_id = $3`, status, accrual, order)
+	err = tx.Commit(ctx)
 	if err != nil {
 		return err
 	}
+	if prev != status && status == "PROCESSED" {
+		metrics.Processed(uploaded, parseAccrual(accrual))
+	}
 
 	return nil
 }
+
+func parseAccrual(accrual string) float64 {
+
+	num, err := strconv.ParseFloat(accrual, 64)
+	if err != nil {
+		return 0
+	}
+
+	return num
+}
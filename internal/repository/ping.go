@@ -2,14 +2,46 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
+// SchemaVersion is the version of the tables the repositories expect.
+// Bump it along with any change of their DDL.
+const SchemaVersion = 4
+
+// schema lists the tables of the repositories, with the columns added to them
+// after they were first created. Keep it in step with their DDL.
+var schema = map[string][]string{
+	"users":              nil,
+	"merchants":          nil,
+	"orders":             {"merchant_id"},
+	"withdrawn":          nil,
+	"transfers":          nil,
+	"settings":           nil,
+	"adjustments":        nil,
+	"webhooks":           {"merchant_id"},
+	"webhook_deliveries": nil,
+	"user_events":        {"event_type"},
+	"schema_version":     nil,
+}
+
 type Pinger interface {
-	PingDB() error
+	PingDB(ctx context.Context) error
+	// CheckSchema reports the newest schema version recorded in the storage,
+	// or an error when the storage lacks a table or column of this release.
+	CheckSchema(ctx context.Context) (int, error)
+	// SetSchemaVersion is called once the tables of version are in place.
+	SetSchemaVersion(ctx context.Context, version int) error
 }
 
 type Ping struct {
@@ -18,19 +50,99 @@ type Ping struct {
 
 func NewPing(cfg config.Config) (*Ping, error) {
 
-	pool := conn.NewConnection(cfg)
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("ping", pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+	if _, err := pool.Exec(ctx, `
+	create table if not exists schema_version (
+		id int primary key default 1 check (id = 1),
+		version int not null
+	);
+`); err != nil {
+		return nil, err
+	}
 
 	return &Ping{
 		pool: pool,
 	}, nil
 }
 
-func (p *Ping) PingDB() error {
+func (p *Ping) PingDB(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+// CheckSchema looks the tables and columns up in the catalog, rather than
+// trusting the recorded version alone: it's what the database contains.
+func (p *Ping) CheckSchema(ctx context.Context) (int, error) {
+
+	tables := make([]string, 0, len(schema))
+	for table := range schema {
+		tables = append(tables, table)
+	}
+
+	rows, err := p.pool.Query(ctx, `select table_name, column_name from information_schema.columns
+		where table_schema = current_schema() and table_name = any($1)`, tables)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]map[string]bool)
+	for rows.Next() {
+		table, column := "", ""
+		err = rows.Scan(&table, &column)
+		if err != nil {
+			return 0, err
+		}
+		if columns[table] == nil {
+			columns[table] = make(map[string]bool)
+		}
+		columns[table][column] = true
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	missing := make([]string, 0)
+	for table, added := range schema {
+		if columns[table] == nil {
+			missing = append(missing, "table "+table)
+			continue
+		}
+		for _, column := range added {
+			if !columns[table][column] {
+				missing = append(missing, "column "+table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return 0, errors.New("missing " + strings.Join(missing, ", "))
+	}
+
+	version := 0
+	err = p.pool.QueryRow(ctx, `select version from schema_version where id = 1`).Scan(&version)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	if version < SchemaVersion {
+		return version, fmt.Errorf("schema version %d, expected %d", version, SchemaVersion)
+	}
+
+	return version, nil
+}
+
+// SetSchemaVersion records version unless a newer one is recorded already,
+// so an instance of an older release doesn't downgrade it.
+func (p *Ping) SetSchemaVersion(ctx context.Context, version int) error {
 
-	pool := p.pool
-	ctx, stop := context.WithCancel(context.Background())
-	defer stop()
-	err := pool.Ping(ctx)
+	_, err := p.pool.Exec(ctx, `insert into schema_version (id, version) values (1, $1)
+		on conflict (id) do update set version = greatest(schema_version.version, excluded.version)`, version)
 
 	return err
 }
@@ -1,21 +1,80 @@
 package repository
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/adjustments"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/events"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/memory"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/merchants"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/orders"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/transactions"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/transfers"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/users"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/webhooks"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/withdrawn"
 )
 
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
 type Pool struct {
-	Users     *users.Repository
-	Orders    *orders.Repository
-	Withdrawn *withdrawn.Repository
-	Ping      *Ping
+	Users        users.Users
+	Merchants    merchants.Merchants
+	Orders       orders.Orders
+	Withdrawn    withdrawn.Withdrawn
+	Transfers    transfers.Transfers
+	Adjustments  adjustments.Adjustments
+	Transactions transactions.Transactions
+	Webhooks     webhooks.Webhooks
+	Events       events.Events
+	Ping         Pinger
 }
 
 func NewReps(cfg config.Config) (*Pool, error) {
 
+	switch cfg.Storage {
+	case StoragePostgres, "":
+		return newPostgresReps(cfg)
+	case StorageMemory:
+		return NewMemoryReps(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage: %s", cfg.Storage)
+	}
+}
+
+// NewMemoryReps keeps everything in process memory. It is meant for tests and demos.
+func NewMemoryReps() *Pool {
+	return NewStoreReps(memory.NewStore())
+}
+
+// NewStoreReps serves the repositories from s, which tests keep to set its clock.
+func NewStoreReps(s *memory.Store) *Pool {
+
+	p := memory.NewPing(s)
+	_ = p.SetSchemaVersion(context.Background(), SchemaVersion)
+
+	return &Pool{
+		Users:        memory.NewUsers(s),
+		Merchants:    memory.NewMerchants(s),
+		Orders:       memory.NewOrders(s),
+		Withdrawn:    memory.NewWithdrawn(s),
+		Transfers:    memory.NewTransfers(s),
+		Adjustments:  memory.NewAdjustments(s),
+		Transactions: memory.NewTransactions(s),
+		Webhooks:     memory.NewWebhooks(s),
+		Events:       memory.NewEvents(s),
+		Ping:         p,
+	}
+}
+
+func newPostgresReps(cfg config.Config) (*Pool, error) {
+
 	u, err := users.NewRepository(cfg)
 	if err != nil {
 		return nil, err
@@ -26,20 +85,64 @@ func NewReps(cfg config.Config) (*Pool, error) {
 		return nil, err
 	}
 
+	m, err := merchants.NewRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	w, err := withdrawn.NewRepository(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	t, err := transfers.NewRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := adjustments.NewRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := transactions.NewRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := webhooks.NewRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := events.NewRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	p, err := NewPing(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	// every table above exists now
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+	err = p.SetSchemaVersion(ctx, SchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Pool{
-		Users:     u,
-		Orders:    o,
-		Withdrawn: w,
-		Ping:      p,
+		Users:        u,
+		Merchants:    m,
+		Orders:       o,
+		Withdrawn:    w,
+		Transfers:    t,
+		Adjustments:  a,
+		Transactions: f,
+		Webhooks:     h,
+		Events:       e,
+		Ping:         p,
 	}, nil
 }
@@ -0,0 +1,657 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/ksuid"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/merchants"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/orders"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/users"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/withdrawn"
+)
+
+// dating makes the transfers that add makes for sender dated at, so the
+// suite crosses a UTC day without waiting for midnight.
+type dating func(t *testing.T, sender string, at time.Time, add func())
+
+// run checks the behaviour every repository backend has to share. The
+// checks take the interfaces only, so the same suite runs against
+// PostgreSQL and the in-memory store.
+func run(t *testing.T, rep *repository.Pool, dated dating) {
+
+	t.Run("schema", func(t *testing.T) { checkSchema(t, rep.Ping) })
+	t.Run("users", func(t *testing.T) { checkUsers(t, rep.Users) })
+	t.Run("orders", func(t *testing.T) { checkOrders(t, rep.Orders) })
+	t.Run("merchants", func(t *testing.T) { checkMerchants(t, rep.Merchants, rep.Orders) })
+	t.Run("withdrawn", func(t *testing.T) { checkWithdrawn(t, rep.Withdrawn, rep.Orders) })
+	t.Run("events", func(t *testing.T) { checkEvents(t, rep) })
+	t.Run("adjustments", func(t *testing.T) { checkAdjustments(t, rep) })
+	t.Run("webhooks", func(t *testing.T) { checkWebhooks(t, rep) })
+	t.Run("transfers", func(t *testing.T) { checkTransfers(t, rep, dated) })
+}
+
+// newID returns a fresh value, so suites can share one database.
+func newID() string {
+	return ksuid.New().String()
+}
+
+// pause makes sure consecutive inserts get distinct timestamps.
+func pause() {
+	time.Sleep(5 * time.Millisecond)
+}
+
+// checkSchema checks that the storage holds the schema of this release once the repositories are built.
+func checkSchema(t *testing.T, rep repository.Pinger) {
+
+	version, err := rep.CheckSchema(context.Background())
+	if err != nil || version != repository.SchemaVersion {
+		t.Errorf("CheckSchema: got %d, %v, want %d", version, err, repository.SchemaVersion)
+	}
+}
+
+// checkUsers checks registration, login and lookup semantics.
+func checkUsers(t *testing.T, rep users.Users) {
+
+	ctx := context.Background()
+	login, ID := newID(), newID()
+
+	if err := rep.AddUserAuthData(ctx, login, "pass", ID); err != nil {
+		t.Fatalf("AddUserAuthData: %v", err)
+	}
+
+	if err := rep.AddUserAuthData(ctx, login, "other", newID()); !errors.Is(err, model.ErrConflict) {
+		t.Errorf("AddUserAuthData with taken login: got %v, want %v", err, model.ErrConflict)
+	}
+
+	tests := []struct {
+		name  string
+		login string
+		pass  string
+		want  string
+		err   error
+	}{
+		{name: "valid", login: login, pass: "pass", want: ID},
+		{name: "wrong password", login: login, pass: "wrong", err: model.ErrWrongPass},
+		{name: "unknown login", login: newID(), pass: "pass", err: model.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rep.GetUserAuthData(ctx, tt.login, tt.pass)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("GetUserAuthData: got %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	got, err := rep.GetUserIDByLogin(ctx, login)
+	if err != nil || got != ID {
+		t.Errorf("GetUserIDByLogin: got %q, %v, want %q", got, err, ID)
+	}
+
+	if _, err = rep.GetUserIDByLogin(ctx, newID()); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("GetUserIDByLogin with unknown login: got %v, want %v", err, model.ErrNotExist)
+	}
+}
+
+// checkOrders checks uploads, listing order, paging and status updates.
+func checkOrders(t *testing.T, rep orders.Orders) {
+
+	ctx := context.Background()
+	user, other := newID(), newID()
+
+	if _, err := rep.GetOrdersByUserID(ctx, user); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("GetOrdersByUserID without orders: got %v, want %v", err, model.ErrNotExist)
+	}
+
+	if _, err := rep.GetUserIDbyOrder(ctx, "", newID()); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("GetUserIDbyOrder with unknown order: got %v, want %v", err, model.ErrNotExist)
+	}
+
+	first, second := newID(), newID()
+	if err := rep.AddOrder(ctx, user, "", first); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	pause()
+	if err := rep.AddOrder(ctx, user, "", second); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+
+	if err := rep.AddOrder(ctx, other, "", first); !errors.Is(err, model.ErrConflict) {
+		t.Errorf("AddOrder with taken number: got %v, want %v", err, model.ErrConflict)
+	}
+
+	owner, err := rep.GetUserIDbyOrder(ctx, "", first)
+	if err != nil || owner != user {
+		t.Errorf("GetUserIDbyOrder: got %q, %v, want %q", owner, err, user)
+	}
+
+	// every merchant has a namespace of its own
+	merchant := newID()
+	if err = rep.AddOrder(ctx, other, merchant, first); err != nil {
+		t.Errorf("AddOrder with a number taken by another merchant: %v", err)
+	}
+	owner, err = rep.GetUserIDbyOrder(ctx, merchant, first)
+	if err != nil || owner != other {
+		t.Errorf("GetUserIDbyOrder of merchant: got %q, %v, want %q", owner, err, other)
+	}
+	if _, err = rep.GetUserIDbyOrder(ctx, merchant, second); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("GetUserIDbyOrder of merchant with number of another: got %v, want %v", err, model.ErrNotExist)
+	}
+
+	list, err := rep.GetOrdersByUserID(ctx, user)
+	if err != nil {
+		t.Fatalf("GetOrdersByUserID: %v", err)
+	}
+	if len(list) != 2 || list[0].Number != second || list[1].Number != first {
+		t.Fatalf("GetOrdersByUserID: got %+v, want newest first", list)
+	}
+	if list[0].Status != "NEW" || list[0].Accrual != 0 {
+		t.Errorf("GetOrdersByUserID: new order is %+v", list[0])
+	}
+
+	page, err := rep.GetOrdersPageByUserID(ctx, user, model.Page{Limit: 1})
+	if err != nil || len(page) != 1 || page[0].Number != second {
+		t.Fatalf("GetOrdersPageByUserID first page: got %+v, %v", page, err)
+	}
+	after := &model.Cursor{Time: page[0].UploadedAt, Key: page[0].Number}
+	page, err = rep.GetOrdersPageByUserID(ctx, user, model.Page{After: after, Limit: 1})
+	if err != nil || len(page) != 1 || page[0].Number != first {
+		t.Fatalf("GetOrdersPageByUserID second page: got %+v, %v", page, err)
+	}
+	after = &model.Cursor{Time: page[0].UploadedAt, Key: page[0].Number}
+	if _, err = rep.GetOrdersPageByUserID(ctx, user, model.Page{After: after, Limit: 1}); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("GetOrdersPageByUserID past the end: got %v, want %v", err, model.ErrNotExist)
+	}
+
+	fresh := newID()
+	inserted, owners, err := rep.AddOrders(ctx, other, "", []string{first, fresh})
+	if err != nil {
+		t.Fatalf("AddOrders: %v", err)
+	}
+	if inserted[first] || !inserted[fresh] {
+		t.Errorf("AddOrders inserted: got %v", inserted)
+	}
+	if owners[first] != user || owners[fresh] != other {
+		t.Errorf("AddOrders owners: got %v", owners)
+	}
+
+	if err = rep.UpdateOrderData(ctx, "", "PROCESSING", "0.0", first); err != nil {
+		t.Fatalf("UpdateOrderData: %v", err)
+	}
+	if !contains(t, rep, "", first) {
+		t.Errorf("GetOrdersForScanner: %s is still pending but missing", first)
+	}
+
+	if err = rep.UpdateOrderData(ctx, "", "PROCESSED", "500", first); err != nil {
+		t.Fatalf("UpdateOrderData: %v", err)
+	}
+	// INVALID and PROCESSED are final
+	if err = rep.UpdateOrderData(ctx, "", "INVALID", "0.0", first); err != nil {
+		t.Fatalf("UpdateOrderData after final status: %v", err)
+	}
+	if contains(t, rep, "", first) {
+		t.Errorf("GetOrdersForScanner: %s is processed but still returned", first)
+	}
+	if !contains(t, rep, merchant, first) {
+		t.Errorf("GetOrdersForScanner: %s of merchant is still pending but missing", first)
+	}
+
+	list, err = rep.GetOrdersByUserID(ctx, user)
+	if err != nil {
+		t.Fatalf("GetOrdersByUserID: %v", err)
+	}
+	for _, o := range list {
+		if o.Number == first && (o.Status != "PROCESSED" || o.Accrual != 500) {
+			t.Errorf("GetOrdersByUserID: processed order is %+v", o)
+		}
+	}
+}
+
+func contains(t *testing.T, rep orders.Orders, merchant, number string) bool {
+
+	list, err := rep.GetOrdersForScanner()
+	if err != nil && !errors.Is(err, model.ErrNotExist) {
+		t.Fatalf("GetOrdersForScanner: %v", err)
+	}
+
+	for _, o := range list {
+		if o.Merchant == merchant && o.Number == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkMerchants checks registration of merchants and the report over their orders.
+func checkMerchants(t *testing.T, rep merchants.Merchants, o orders.Orders) {
+
+	ctx := context.Background()
+	ID, user, other := newID(), newID(), newID()
+
+	if _, err := rep.GetMerchant(ctx, ID); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("GetMerchant with unknown ID: got %v, want %v", err, model.ErrNotExist)
+	}
+	if _, err := rep.UpdateMerchant(ctx, model.Merchant{ID: ID, Name: "acme"}); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("UpdateMerchant with unknown ID: got %v, want %v", err, model.ErrNotExist)
+	}
+
+	added, err := rep.AddMerchant(ctx, model.Merchant{ID: ID, Name: "acme", Validator: "damm"})
+	if err != nil || added.CreatedAt.IsZero() {
+		t.Fatalf("AddMerchant: got %+v, %v", added, err)
+	}
+	if _, err = rep.AddMerchant(ctx, model.Merchant{ID: ID, Name: "other"}); !errors.Is(err, model.ErrConflict) {
+		t.Errorf("AddMerchant with taken ID: got %v, want %v", err, model.ErrConflict)
+	}
+
+	_, err = rep.UpdateMerchant(ctx, model.Merchant{ID: ID, Name: "Acme", AccrualAddress: "http://acme"})
+	if err != nil {
+		t.Fatalf("UpdateMerchant: %v", err)
+	}
+	got, err := rep.GetMerchant(ctx, ID)
+	if err != nil || got.Name != "Acme" || got.AccrualAddress != "http://acme" || got.Validator != "" || !got.CreatedAt.Equal(added.CreatedAt) {
+		t.Errorf("GetMerchant after update: got %+v, %v", got, err)
+	}
+
+	list, err := rep.GetMerchants(ctx)
+	found := false
+	for _, m := range list {
+		found = found || m.ID == ID
+	}
+	if err != nil || !found {
+		t.Errorf("GetMerchants: %s missing from %+v, %v", ID, list, err)
+	}
+
+	first, second := newID(), newID()
+	for _, add := range []struct{ user, number string }{{user, first}, {user, second}, {other, newID()}} {
+		if err = o.AddOrder(ctx, add.user, ID, add.number); err != nil {
+			t.Fatalf("AddOrder: %v", err)
+		}
+	}
+	if err = o.AddOrder(ctx, user, "", newID()); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	if err = o.UpdateOrderData(ctx, ID, "PROCESSED", "500", first); err != nil {
+		t.Fatalf("UpdateOrderData: %v", err)
+	}
+
+	report, err := rep.GetReport(ctx, ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("GetReport: %v", err)
+	}
+	if report.Orders != 3 || report.Users != 2 || report.Accrued != 500 || report.Statuses["PROCESSED"] != 1 || report.Statuses["NEW"] != 2 {
+		t.Errorf("GetReport: got %+v", report)
+	}
+
+	report, err = rep.GetReport(ctx, ID, time.Now().Add(time.Hour), time.Time{})
+	if err != nil || report.Orders != 0 {
+		t.Errorf("GetReport from the future: got %+v, %v", report, err)
+	}
+
+	if _, err = rep.GetReport(ctx, newID(), time.Time{}, time.Time{}); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("GetReport with unknown ID: got %v, want %v", err, model.ErrNotExist)
+	}
+
+	// the same number of two merchants: the cursor needs the merchant to tell them apart
+	number := newID()
+	for _, merchant := range []string{"", ID} {
+		if err = o.AddOrder(ctx, user, merchant, number); err != nil {
+			t.Fatalf("AddOrder: %v", err)
+		}
+	}
+	page, err := o.GetOrdersPageByUserID(ctx, user, model.Page{Limit: 1})
+	if err != nil || len(page) != 1 || page[0].Merchant != ID || page[0].Number != number {
+		t.Fatalf("GetOrdersPageByUserID first page: got %+v, %v", page, err)
+	}
+	after := &model.Cursor{Time: page[0].UploadedAt, Merchant: ID, Key: number}
+	page, err = o.GetOrdersPageByUserID(ctx, user, model.Page{After: after, Limit: 1})
+	if err != nil || len(page) != 1 || page[0].Merchant != "" || page[0].Number != number {
+		t.Errorf("GetOrdersPageByUserID second page: got %+v, %v", page, err)
+	}
+	after.Merchant = ID + "z"
+	page, err = o.GetOrdersPageByUserID(ctx, user, model.Page{After: after, Limit: 1})
+	if err != nil || len(page) != 1 || page[0].Merchant != ID || page[0].Number != number {
+		t.Errorf("GetOrdersPageByUserID after a greater merchant at the same time: got %+v, %v", page, err)
+	}
+}
+
+// checkWithdrawn checks recording and listing of withdrawals, and that they can't overdraw the balance.
+func checkWithdrawn(t *testing.T, rep withdrawn.Withdrawn, o orders.Orders) {
+
+	ctx := context.Background()
+	user := newID()
+
+	if _, err := rep.GetWithdrawnOrdersByUserID(ctx, user); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("GetWithdrawnOrdersByUserID without withdrawals: got %v, want %v", err, model.ErrNotExist)
+	}
+
+	if err := rep.AddWithdrawnOrder(ctx, user, "2377225624", "751"); !errors.Is(err, model.ErrInsufficientFunds) {
+		t.Errorf("AddWithdrawnOrder without balance: got %v, want %v", err, model.ErrInsufficientFunds)
+	}
+
+	accrued := newID()
+	if err := o.AddOrder(ctx, user, "", accrued); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	if err := o.UpdateOrderData(ctx, "", "PROCESSED", "751.50", accrued); err != nil {
+		t.Fatalf("UpdateOrderData: %v", err)
+	}
+
+	if err := rep.AddWithdrawnOrder(ctx, user, "2377225624", "751"); err != nil {
+		t.Fatalf("AddWithdrawnOrder: %v", err)
+	}
+	pause()
+	if err := rep.AddWithdrawnOrder(ctx, user, "12345678903", "0.5"); err != nil {
+		t.Fatalf("AddWithdrawnOrder: %v", err)
+	}
+	if err := rep.AddWithdrawnOrder(ctx, user, "79927398713", "0.01"); !errors.Is(err, model.ErrInsufficientFunds) {
+		t.Errorf("AddWithdrawnOrder over the balance: got %v, want %v", err, model.ErrInsufficientFunds)
+	}
+
+	if sum, err := o.GetAccrualSum(ctx, user); err != nil || sum != 751.5 {
+		t.Errorf("GetAccrualSum: got %v, %v, want 751.5", sum, err)
+	}
+	if sum, err := rep.GetWithdrawnSum(ctx, user); err != nil || sum != 751.5 {
+		t.Errorf("GetWithdrawnSum: got %v, %v, want 751.5", sum, err)
+	}
+
+	list, err := rep.GetWithdrawnOrdersByUserID(ctx, user)
+	if err != nil {
+		t.Fatalf("GetWithdrawnOrdersByUserID: %v", err)
+	}
+	if len(list) != 2 || list[0].Order != "12345678903" || list[1].Order != "2377225624" {
+		t.Fatalf("GetWithdrawnOrdersByUserID: got %+v, want newest first", list)
+	}
+	if list[0].Accrual != 0.5 || list[1].Accrual != 751 {
+		t.Errorf("GetWithdrawnOrdersByUserID: sums are %v and %v", list[0].Accrual, list[1].Accrual)
+	}
+
+	page, err := rep.GetWithdrawnPageByUserID(ctx, user, model.Page{Limit: 1})
+	if err != nil || len(page) != 1 || page[0].Order != "12345678903" {
+		t.Fatalf("GetWithdrawnPageByUserID first page: got %+v, %v", page, err)
+	}
+	after := &model.Cursor{Time: page[0].ProcessedAt, Key: page[0].Order}
+	page, err = rep.GetWithdrawnPageByUserID(ctx, user, model.Page{After: after, Limit: 1})
+	if err != nil || len(page) != 1 || page[0].Order != "2377225624" {
+		t.Fatalf("GetWithdrawnPageByUserID second page: got %+v, %v", page, err)
+	}
+}
+
+// checkEvents checks that accruals, withdrawals and transfers are recorded as user events in order.
+func checkEvents(t *testing.T, rep *repository.Pool) {
+
+	ctx := context.Background()
+	sender, recipient, order := newID(), newID(), newID()
+
+	if err := rep.Orders.AddOrder(ctx, sender, "", order); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	if err := rep.Orders.UpdateOrderData(ctx, "", "PROCESSED", "100", order); err != nil {
+		t.Fatalf("UpdateOrderData: %v", err)
+	}
+	if err := rep.Withdrawn.AddWithdrawnOrder(ctx, sender, "2377225624", "10.00"); err != nil {
+		t.Fatalf("AddWithdrawnOrder: %v", err)
+	}
+	if err := rep.Transfers.AddTransfer(ctx, sender, recipient, "20.00", 0); err != nil {
+		t.Fatalf("AddTransfer: %v", err)
+	}
+
+	list, err := rep.Events.GetEventsAfter(ctx, sender, 0)
+	if err != nil {
+		t.Fatalf("GetEventsAfter: %v", err)
+	}
+	want := []string{model.UserEventOrder, model.UserEventBalance, model.UserEventBalance}
+	if len(list) != len(want) {
+		t.Fatalf("GetEventsAfter: got %+v, want types %v", list, want)
+	}
+	for i, event := range list {
+		if event.Type != want[i] || (i > 0 && event.ID <= list[i-1].ID) {
+			t.Errorf("GetEventsAfter: event %d is %+v, want type %s and a growing ID", i, event, want[i])
+		}
+	}
+	if list[0].Order != order || list[0].Status != "PROCESSED" || list[0].Accrual != 100 {
+		t.Errorf("GetEventsAfter: order event is %+v", list[0])
+	}
+
+	after, err := rep.Events.GetEventsAfter(ctx, sender, list[0].ID)
+	if err != nil || len(after) != 2 {
+		t.Errorf("GetEventsAfter the first event: got %+v, %v", after, err)
+	}
+
+	list, err = rep.Events.GetEventsAfter(ctx, recipient, 0)
+	if err != nil || len(list) != 1 || list[0].Type != model.UserEventBalance {
+		t.Errorf("GetEventsAfter for the recipient: got %+v, %v", list, err)
+	}
+}
+
+// checkAdjustments checks admin adjustments and reversals of withdrawals, and their place in the transaction feed.
+func checkAdjustments(t *testing.T, rep *repository.Pool) {
+
+	ctx := context.Background()
+	user := newID()
+
+	if err := rep.Adjustments.AddAdjustment(ctx, user, "goodwill", "-1.00"); !errors.Is(err, model.ErrInsufficientFunds) {
+		t.Errorf("AddAdjustment debiting an empty balance: got %v, want %v", err, model.ErrInsufficientFunds)
+	}
+	if err := rep.Adjustments.AddAdjustment(ctx, user, "goodwill", "50.00"); err != nil {
+		t.Fatalf("AddAdjustment: %v", err)
+	}
+	pause()
+	if err := rep.Withdrawn.AddWithdrawnOrder(ctx, user, "2377225624", "30.00"); err != nil {
+		t.Fatalf("AddWithdrawnOrder: %v", err)
+	}
+	pause()
+
+	if err := rep.Adjustments.ReverseWithdrawal(ctx, user, "12345678903"); !errors.Is(err, model.ErrNotExist) {
+		t.Errorf("ReverseWithdrawal of an unknown order: got %v, want %v", err, model.ErrNotExist)
+	}
+	if err := rep.Adjustments.ReverseWithdrawal(ctx, user, "2377225624"); err != nil {
+		t.Fatalf("ReverseWithdrawal: %v", err)
+	}
+	if err := rep.Adjustments.ReverseWithdrawal(ctx, user, "2377225624"); !errors.Is(err, model.ErrConflict) {
+		t.Errorf("ReverseWithdrawal twice: got %v, want %v", err, model.ErrConflict)
+	}
+	pause()
+	if err := rep.Adjustments.AddAdjustment(ctx, user, "correction", "-45.50"); err != nil {
+		t.Fatalf("AddAdjustment debiting: %v", err)
+	}
+
+	net, err := rep.Adjustments.GetAdjustmentsBalance(ctx, user)
+	if err != nil || net != 34.5 {
+		t.Errorf("GetAdjustmentsBalance: got %v, %v, want 34.5", net, err)
+	}
+
+	list, err := rep.Transactions.GetTransactionsByUserID(ctx, user, model.TransactionFilter{
+		Types: []string{model.TransactionAdjustment, model.TransactionReversal},
+	})
+	if err != nil {
+		t.Fatalf("GetTransactionsByUserID: %v", err)
+	}
+	if len(list) != 3 || list[0].Type != model.TransactionAdjustment || list[0].Sum != -45.5 ||
+		list[1].Type != model.TransactionReversal || list[1].Reference != "2377225624" || list[1].Sum != 30 ||
+		list[2].Reference != "goodwill" || list[2].Sum != 50 {
+		t.Errorf("GetTransactionsByUserID: got %+v", list)
+	}
+}
+
+// checkWebhooks checks that events go to the webhooks of their merchant and to
+// those of no merchant only, and that claimed deliveries stay leased.
+func checkWebhooks(t *testing.T, rep *repository.Pool) {
+
+	ctx := context.Background()
+	user, merchant, number := newID(), newID(), newID()
+	events := []string{model.EventOrderProcessed, model.EventWithdrawalCreated}
+
+	names := make(map[int64]string)
+	for name, m := range map[string]string{"operator": "", "merchant": merchant, "other merchant": newID()} {
+		hook, err := rep.Webhooks.AddWebhook(ctx, m, "http://example.com/hook", "secret", events)
+		if err != nil || hook.Merchant != m {
+			t.Fatalf("AddWebhook: got %+v, %v", hook, err)
+		}
+		names[hook.ID] = name
+		defer rep.Webhooks.DeleteWebhook(ctx, hook.ID)
+	}
+
+	if err := rep.Orders.AddOrder(ctx, user, merchant, number); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	if err := rep.Orders.UpdateOrderData(ctx, merchant, "PROCESSED", "100", number); err != nil {
+		t.Fatalf("UpdateOrderData: %v", err)
+	}
+	if err := rep.Withdrawn.AddWithdrawnOrder(ctx, user, newID(), "10"); err != nil {
+		t.Fatalf("AddWithdrawnOrder: %v", err)
+	}
+
+	list, err := rep.Webhooks.ClaimDeliveries(ctx, 1000, 60)
+	if err != nil {
+		t.Fatalf("ClaimDeliveries: %v", err)
+	}
+	got := make(map[string]int)
+	for _, d := range list {
+		if name, ok := names[d.WebhookID]; ok {
+			got[name+" "+d.EventType]++
+		}
+	}
+	want := map[string]int{
+		"operator " + model.EventOrderProcessed:    1,
+		"operator " + model.EventWithdrawalCreated: 1,
+		"merchant " + model.EventOrderProcessed:    1,
+	}
+	if len(got) != len(want) {
+		t.Errorf("ClaimDeliveries: got %v, want %v", got, want)
+	}
+	for key, n := range want {
+		if got[key] != n {
+			t.Errorf("ClaimDeliveries: got %v, want %v", got, want)
+			break
+		}
+	}
+
+	list, err = rep.Webhooks.ClaimDeliveries(ctx, 1000, 60)
+	if err != nil {
+		t.Fatalf("ClaimDeliveries again: %v", err)
+	}
+	for _, d := range list {
+		if _, ok := names[d.WebhookID]; ok {
+			t.Errorf("ClaimDeliveries again: leased delivery %+v claimed twice", d)
+		}
+	}
+}
+
+// checkTransfers checks what AddTransfer refuses: transfers to self, all
+// transfers while the kill switch is off, overdrafts, and transfers past the
+// daily limit, counted over the UTC day.
+func checkTransfers(t *testing.T, rep *repository.Pool, dated dating) {
+
+	ctx := context.Background()
+
+	// funded returns a new user holding 200 points
+	funded := func(t *testing.T) string {
+		t.Helper()
+		user := newID()
+		if err := rep.Adjustments.AddAdjustment(ctx, user, "funds", "200.00"); err != nil {
+			t.Fatalf("AddAdjustment: %v", err)
+		}
+		return user
+	}
+
+	t.Run("self", func(t *testing.T) {
+		user := funded(t)
+		if err := rep.Transfers.AddTransfer(ctx, user, user, "1.00", 0); !errors.Is(err, model.ErrSelfTransfer) {
+			t.Errorf("AddTransfer to self: got %v, want %v", err, model.ErrSelfTransfer)
+		}
+	})
+
+	t.Run("insufficient funds", func(t *testing.T) {
+		user := funded(t)
+		if err := rep.Transfers.AddTransfer(ctx, user, newID(), "200.01", 0); !errors.Is(err, model.ErrInsufficientFunds) {
+			t.Errorf("AddTransfer past the balance: got %v, want %v", err, model.ErrInsufficientFunds)
+		}
+		if err := rep.Transfers.AddTransfer(ctx, user, newID(), "200.00", 0); err != nil {
+			t.Errorf("AddTransfer of the whole balance: %v", err)
+		}
+		if net, err := rep.Transfers.GetTransfersBalance(ctx, user); err != nil || net != -200 {
+			t.Errorf("GetTransfersBalance: got %v, %v, want -200", net, err)
+		}
+	})
+
+	t.Run("kill switch", func(t *testing.T) {
+		user := funded(t)
+		if on, err := rep.Transfers.Enabled(ctx); err != nil || !on {
+			t.Fatalf("Enabled before it is set: got %v, %v, want true", on, err)
+		}
+
+		// the switch is shared by the suite, never leave it off
+		defer rep.Transfers.SetEnabled(ctx, true)
+		for i := 0; i < 2; i++ {
+			if err := rep.Transfers.SetEnabled(ctx, false); err != nil {
+				t.Fatalf("SetEnabled(false): %v", err)
+			}
+		}
+		if on, err := rep.Transfers.Enabled(ctx); err != nil || on {
+			t.Errorf("Enabled after SetEnabled(false): got %v, %v, want false", on, err)
+		}
+		if err := rep.Transfers.AddTransfer(ctx, user, newID(), "1.00", 0); !errors.Is(err, model.ErrTransfersDisabled) {
+			t.Errorf("AddTransfer while disabled: got %v, want %v", err, model.ErrTransfersDisabled)
+		}
+
+		if err := rep.Transfers.SetEnabled(ctx, true); err != nil {
+			t.Fatalf("SetEnabled(true): %v", err)
+		}
+		if on, err := rep.Transfers.Enabled(ctx); err != nil || !on {
+			t.Errorf("Enabled after SetEnabled(true): got %v, %v, want true", on, err)
+		}
+		if err := rep.Transfers.AddTransfer(ctx, user, newID(), "1.00", 0); err != nil {
+			t.Errorf("AddTransfer enabled again: %v", err)
+		}
+	})
+
+	midnight := time.Now().UTC().Truncate(24 * time.Hour)
+	tests := []struct {
+		name  string
+		limit float64
+		// earlier is transferred at, before the transfers of today
+		at      time.Time
+		earlier string
+		today   []string
+		want    error
+	}{
+		{name: "within the limit", limit: 50, today: []string{"20.00", "30.00"}},
+		{name: "past the limit", limit: 50, today: []string{"20.00", "30.01"}, want: model.ErrLimitExceeded},
+		{name: "no limit", today: []string{"60.00"}},
+		{name: "yesterday not counted", limit: 50, at: midnight.Add(-time.Second), earlier: "40.00", today: []string{"50.00"}},
+		{name: "midnight counted", limit: 50, at: midnight, earlier: "40.00", today: []string{"10.01"}, want: model.ErrLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run("daily limit/"+tt.name, func(t *testing.T) {
+
+			user := funded(t)
+			if tt.earlier != "" {
+				dated(t, user, tt.at, func() {
+					if err := rep.Transfers.AddTransfer(ctx, user, newID(), tt.earlier, 0); err != nil {
+						t.Fatalf("AddTransfer at %v: %v", tt.at, err)
+					}
+				})
+			}
+
+			var err error
+			for _, sum := range tt.today {
+				if err = rep.Transfers.AddTransfer(ctx, user, newID(), sum, tt.limit); err != nil {
+					break
+				}
+			}
+			if tt.want == nil && err != nil {
+				t.Fatalf("AddTransfer: %v", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("AddTransfer: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
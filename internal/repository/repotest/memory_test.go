@@ -0,0 +1,19 @@
+package repotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/memory"
+)
+
+func TestMemory(t *testing.T) {
+
+	s := memory.NewStore()
+	run(t, repository.NewStoreReps(s), func(t *testing.T, sender string, at time.Time, add func()) {
+		s.SetClock(func() time.Time { return at })
+		defer s.SetClock(nil)
+		add()
+	})
+}
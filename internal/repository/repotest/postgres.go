@@ -0,0 +1,91 @@
+// Package repotest starts disposable PostgreSQL servers, so the repository
+// contract suite and the end-to-end tests can run against the real backend.
+package repotest
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Postgres starts a throwaway server in a temp directory and returns its
+// connection string. The server is stopped when the test ends.
+// The test is skipped when no postgres binaries are found. PG_BIN may point
+// to the directory holding initdb and pg_ctl.
+func Postgres(t *testing.T) string {
+
+	t.Helper()
+
+	bin, ok := pgBin()
+	if !ok {
+		t.Skip("postgres binaries not found, set PG_BIN to run")
+	}
+	// initdb refuses to run as root
+	if os.Geteuid() == 0 {
+		t.Skip("postgres can't be started by root")
+	}
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+
+	out, err := exec.Command(filepath.Join(bin, "initdb"), "-D", data, "-U", "postgres", "-A", "trust", "-N").CombinedOutput()
+	if err != nil {
+		t.Fatalf("initdb: %v\n%s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pgCtl := filepath.Join(bin, "pg_ctl")
+	opts := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, dir)
+	out, err = exec.Command(pgCtl, "-D", data, "-o", opts, "-l", filepath.Join(dir, "log"), "-w", "start").CombinedOutput()
+	if err != nil {
+		t.Fatalf("pg_ctl start: %v\n%s", err, out)
+	}
+
+	t.Cleanup(func() {
+		if out, err := exec.Command(pgCtl, "-D", data, "-m", "immediate", "stop").CombinedOutput(); err != nil {
+			t.Logf("pg_ctl stop: %v\n%s", err, out)
+		}
+	})
+
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port)
+}
+
+func pgBin() (string, bool) {
+
+	dirs := []string{os.Getenv("PG_BIN")}
+	if path, err := exec.LookPath("initdb"); err == nil {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	found, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	dirs = append(dirs, found...)
+	dirs = append(dirs, "/usr/local/pgsql/bin", "/opt/homebrew/bin")
+
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, "pg_ctl")); err == nil {
+			return dir, true
+		}
+	}
+
+	return "", false
+}
+
+func freePort() (int, error) {
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
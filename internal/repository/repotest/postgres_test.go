@@ -0,0 +1,40 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+)
+
+// TestPostgres runs the whole suite against a fresh server with the schema
+// applied by the repositories themselves.
+func TestPostgres(t *testing.T) {
+
+	cfg := config.Default()
+	cfg.DatabaseURI = Postgres(t)
+	cfg.Storage = repository.StoragePostgres
+
+	rep, err := repository.NewReps(cfg)
+	if err != nil {
+		t.Fatalf("NewReps: %v", err)
+	}
+
+	// the clock of the server can't move: the transfers are dated afterwards
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		t.Fatalf("NewConnection: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	run(t, rep, func(t *testing.T, sender string, at time.Time, add func()) {
+		add()
+		_, err := pool.Exec(context.Background(), `update transfers set processed_time = $2 where sender_id = $1`, sender, at)
+		if err != nil {
+			t.Fatalf("dating transfers: %v", err)
+		}
+	})
+}
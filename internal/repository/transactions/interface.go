@@ -0,0 +1,11 @@
+package transactions
+
+import (
+	"context"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Transactions interface {
+	GetTransactionsByUserID(ctx context.Context, userID string, filter model.TransactionFilter) ([]model.Transaction, error)
+}
@@ -0,0 +1,123 @@
+package transactions
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Repository reads a single feed over the orders, withdrawn, transfers and adjustments tables,
+// so it owns no tables itself.
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(cfg config.Config) (*Repository, error) {
+
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("transactions", pool)
+
+	return &Repository{
+		pool: pool,
+	}, nil
+}
+
+const feed = `
+	select 'accrual' as kind, order_id as ref, order_status as status, order_accrual as amount, upload_time as ts
+		from orders where user_id = $1
+	union all
+	select 'withdrawal', order_id, 'PROCESSED', order_accrual, processed_time
+		from withdrawn where user_id = $1
+	union all
+	select 'transfer_out', u.user_login, 'PROCESSED', t.amount, t.processed_time
+		from transfers t join users u on u.user_id = t.recipient_id where t.sender_id = $1
+	union all
+	select 'transfer_in', u.user_login, 'PROCESSED', t.amount, t.processed_time
+		from transfers t join users u on u.user_id = t.sender_id where t.recipient_id = $1
+	union all
+	select kind, reference, 'PROCESSED', amount, processed_time
+		from adjustments where user_id = $1`
+
+func (p *Repository) GetTransactionsByUserID(ctx context.Context, userID string, filter model.TransactionFilter) ([]model.Transaction, error) {
+
+	args := []any{userID}
+	where := make([]string, 0)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if len(filter.Types) > 0 {
+		where = append(where, "kind = any("+arg(filter.Types)+")")
+	}
+	if len(filter.Statuses) > 0 {
+		where = append(where, "status = any("+arg(filter.Statuses)+")")
+	}
+	// the columns are timestamps without time zone in UTC, and pgx
+	// sends a time's wall clock as is: compare UTC wall clocks
+	if !filter.From.IsZero() {
+		where = append(where, "ts >= "+arg(filter.From.UTC()))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "ts < "+arg(filter.To.UTC()))
+	}
+	if filter.After != nil {
+		where = append(where, fmt.Sprintf("(ts, kind, ref) < (%s, %s, %s)",
+			arg(filter.After.ProcessedAt.UTC()), arg(filter.After.Type), arg(filter.After.Reference)))
+	}
+
+	query := "select kind, ref, status, amount, ts from (" + feed + ") feed"
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by ts desc, kind desc, ref desc"
+	// a zero limit returns them all, as for model.Page
+	if filter.Limit > 0 {
+		query += " limit " + arg(filter.Limit)
+	}
+
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Transaction, 0)
+
+	for rows.Next() {
+
+		var amount string
+		var tr model.Transaction
+
+		err = rows.Scan(&tr.Type, &tr.Reference, &tr.Status, &amount, &tr.ProcessedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		tr.Sum, err = strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, tr)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
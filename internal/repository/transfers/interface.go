@@ -0,0 +1,15 @@
+package transfers
+
+import (
+	"context"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Transfers interface {
+	AddTransfer(ctx context.Context, senderID, recipientID, sum string, dailyLimit float64) error
+	GetTransfersByUserID(ctx context.Context, userID string) ([]model.TransferRecord, error)
+	GetTransfersBalance(ctx context.Context, userID string) (float64, error)
+	Enabled(ctx context.Context) (bool, error)
+	SetEnabled(ctx context.Context, enabled bool) error
+}
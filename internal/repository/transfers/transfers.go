@@ -0,0 +1,235 @@
+package transfers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/events"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const (
+	settingEnabled = "transfers_enabled"
+	selectEnabled  = `select value from settings where name = $1`
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(cfg config.Config) (*Repository, error) {
+
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("transfers", pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+	if _, err := pool.Exec(ctx, `
+	create table if not exists transfers (
+		sender_id varchar(27) not null,
+		recipient_id varchar(27) not null,
+		amount text not null,
+		processed_time timestamp not null default current_timestamp
+	);
+	create index if not exists transfers_sender_id_processed_time_idx on transfers (sender_id, processed_time);
+	create index if not exists transfers_recipient_id_processed_time_idx on transfers (recipient_id, processed_time);
+	create table if not exists settings (
+		name text primary key,
+		value text not null
+	);
+`); err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		pool: pool,
+	}, nil
+}
+
+// AddTransfer debits the sender and credits the recipient in a single transaction
+// and records a balance event for both.
+// Debits of one sender are serialized by LockBalance, so the balance
+// and the daily limit are checked against a consistent state. Transfers to
+// self and, while the kill switch is off, all transfers are refused.
+func (p *Repository) AddTransfer(ctx context.Context, senderID, recipientID, sum string, dailyLimit float64) error {
+
+	amount, err := strconv.ParseFloat(sum, 64)
+	if err != nil {
+		return err
+	}
+	if senderID == recipientID {
+		return model.ErrSelfTransfer
+	}
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	on, err := enabled(tx.QueryRow(ctx, selectEnabled, settingEnabled))
+	if err != nil {
+		return err
+	}
+	if !on {
+		return model.ErrTransfersDisabled
+	}
+
+	balance, err := LockBalance(ctx, tx, senderID)
+	if err != nil {
+		return err
+	}
+	if balance < amount {
+		return model.ErrInsufficientFunds
+	}
+
+	today := 0.0
+	err = tx.QueryRow(ctx, `select coalesce(sum(amount::numeric), 0)::float8 from transfers
+		where sender_id = $1 and processed_time >= date_trunc('day', current_timestamp)`, senderID).
+		Scan(&today)
+	if err != nil {
+		return err
+	}
+	if dailyLimit > 0 && today+amount > dailyLimit {
+		return model.ErrLimitExceeded
+	}
+
+	_, err = tx.Exec(ctx, `insert into transfers (sender_id, recipient_id, amount) values ($1, $2, $3)`, senderID, recipientID, sum)
+	if err != nil {
+		return err
+	}
+
+	err = events.Lock(ctx, tx, senderID, recipientID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range []string{senderID, recipientID} {
+		err = events.RecordBalance(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (p *Repository) GetTransfersByUserID(ctx context.Context, userID string) ([]model.TransferRecord, error) {
+
+	rows, err := p.pool.Query(ctx, `
+	select 'out', u.user_login, t.amount, t.processed_time from transfers t
+		join users u on u.user_id = t.recipient_id where t.sender_id = $1
+	union all
+	select 'in', u.user_login, t.amount, t.processed_time from transfers t
+		join users u on u.user_id = t.sender_id where t.recipient_id = $1
+	order by 4 desc`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.TransferRecord, 0)
+
+	for rows.Next() {
+
+		var amount string
+		var record model.TransferRecord
+
+		err = rows.Scan(&record.Direction, &record.User, &amount, &record.ProcessedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Sum, err = strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+// GetTransfersBalance returns the net result of transfers for the user: received minus sent.
+func (p *Repository) GetTransfersBalance(ctx context.Context, userID string) (float64, error) {
+
+	net := 0.0
+	err := p.pool.QueryRow(ctx, `select
+		coalesce((select sum(amount::numeric) from transfers where recipient_id = $1), 0)::float8 -
+		coalesce((select sum(amount::numeric) from transfers where sender_id = $1), 0)::float8`, userID).
+		Scan(&net)
+	if err != nil {
+		return 0, err
+	}
+
+	return net, nil
+}
+
+func (p *Repository) Enabled(ctx context.Context) (bool, error) {
+	return enabled(p.pool.QueryRow(ctx, selectEnabled, settingEnabled))
+}
+
+// enabled reads the kill switch of transfers, on while it was never set.
+func enabled(row pgx.Row) (bool, error) {
+
+	value := ""
+	err := row.Scan(&value)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return strconv.ParseBool(value)
+}
+
+func (p *Repository) SetEnabled(ctx context.Context, enabled bool) error {
+
+	_, err := p.pool.Exec(ctx, `insert into settings (name, value) values ($1, $2)
+		on conflict (name) do update set value = excluded.value`, settingEnabled, strconv.FormatBool(enabled))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// LockBalance takes the user's advisory lock until the end of tx and returns the balance under it.
+// Withdrawals and transfers both debit through it, so concurrent debits can't overdraw the user.
+func LockBalance(ctx context.Context, tx pgx.Tx, userID string) (float64, error) {
+
+	_, err := tx.Exec(ctx, `select pg_advisory_xact_lock(hashtext($1))`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	current := 0.0
+	err = tx.QueryRow(ctx, `select
+		coalesce((select sum(order_accrual::numeric) from orders where user_id = $1), 0)::float8 -
+		coalesce((select sum(order_accrual::numeric) from withdrawn where user_id = $1), 0)::float8 -
+		coalesce((select sum(amount::numeric) from transfers where sender_id = $1), 0)::float8 +
+		coalesce((select sum(amount::numeric) from transfers where recipient_id = $1), 0)::float8 +
+		coalesce((select sum(amount::numeric) from adjustments where user_id = $1), 0)::float8`, userID).
+		Scan(&current)
+	if err != nil {
+		return 0, err
+	}
+
+	return current, nil
+}
@@ -7,4 +7,5 @@ import (
 type Users interface {
 	AddUserAuthData(ctx context.Context, login, pass, token string) error
 	GetUserAuthData(ctx context.Context, login, pass string) (string, error)
+	GetUserIDByLogin(ctx context.Context, login string) (string, error)
 }
@@ -6,8 +6,11 @@ import (
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/crypt"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/tracing"
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -17,7 +20,12 @@ type Repository struct {
 
 func NewRepository(cfg config.Config) (*Repository, error) {
 
-	pool := conn.NewConnection(cfg)
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("users", pool)
+
 	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
 	defer cancel()
 	if _, err := pool.Exec(ctx, `	
@@ -37,7 +45,9 @@ func NewRepository(cfg config.Config) (*Repository, error) {
 
 func (p *Repository) AddUserAuthData(ctx context.Context, login, pass, ID string) error {
 
+	_, span := tracing.Start(ctx, "bcrypt hash")
 	hash, err := crypt.HashPassword(pass)
+	span.End()
 	if err != nil {
 		return err
 	}
@@ -53,6 +63,7 @@ func (p *Repository) AddUserAuthData(ctx context.Context, login, pass, ID string
 
 		return err
 	}
+	metrics.Registrations.Inc()
 
 	return nil
 }
@@ -63,12 +74,33 @@ func (p *Repository) GetUserAuthData(ctx context.Context, login, pass string) (s
 	err := p.pool.QueryRow(ctx, `select user_login, user_pass, user_id from users where user_login = $1`, login).
 		Scan(&l, &ps, &ID)
 	if err != nil {
-		return "", model.ErrNotExist
+		if err == pgx.ErrNoRows {
+			return "", model.ErrNotExist
+		}
+		return "", err
 	}
 
-	if !crypt.CheckPasswordHash(pass, ps) {
+	_, span := tracing.Start(ctx, "bcrypt compare")
+	ok := crypt.CheckPasswordHash(pass, ps)
+	span.End()
+	if !ok {
 		return "", model.ErrWrongPass
 	}
 
 	return ID, nil
 }
+
+func (p *Repository) GetUserIDByLogin(ctx context.Context, login string) (string, error) {
+
+	ID := ""
+	err := p.pool.QueryRow(ctx, `select user_id from users where user_login = $1`, login).
+		Scan(&ID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", model.ErrNotExist
+		}
+		return "", err
+	}
+
+	return ID, nil
+}
@@ -0,0 +1,18 @@
+package webhooks
+
+import (
+	"context"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+type Webhooks interface {
+	AddWebhook(ctx context.Context, merchant, url, secret string, events []string) (model.Webhook, error)
+	GetWebhooks(ctx context.Context) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, ID int64) error
+	ClaimDeliveries(ctx context.Context, limit int, lease float64) ([]model.Delivery, error)
+	MarkDelivered(ctx context.Context, ID int64) error
+	MarkFailed(ctx context.Context, ID int64, reason string, retryIn float64, dead bool) error
+	GetDeliveries(ctx context.Context, status string) ([]model.Delivery, error)
+	Redeliver(ctx context.Context, ID int64) error
+}
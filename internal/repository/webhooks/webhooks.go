@@ -0,0 +1,261 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/segmentio/ksuid"
+)
+
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(cfg config.Config) (*Repository, error) {
+
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("webhooks", pool)
+
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+	if _, err := pool.Exec(ctx, `
+	create table if not exists webhooks (
+		id bigserial primary key,
+		merchant_id text not null default '',
+		url text not null,
+		secret text not null,
+		events text[] not null,
+		created_time timestamp not null default current_timestamp
+	);
+	alter table webhooks add column if not exists merchant_id text not null default '';
+	create table if not exists webhook_deliveries (
+		id bigserial primary key,
+		webhook_id bigint not null references webhooks (id) on delete cascade,
+		event_id varchar(27) not null,
+		event_type text not null,
+		payload bytea not null,
+		status text not null default 'pending',
+		attempts int not null default 0,
+		last_error text not null default '',
+		next_attempt_time timestamp not null default current_timestamp,
+		created_time timestamp not null default current_timestamp
+	);
+	create index if not exists webhook_deliveries_pending_idx on webhook_deliveries (next_attempt_time)
+		where status = 'pending';
+`); err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		pool: pool,
+	}, nil
+}
+
+// Enqueue writes the event to the outbox within the caller's transaction,
+// one delivery per webhook subscribed to the event type: the webhooks of
+// merchant and those of no merchant. Events of no merchant, like
+// withdrawals, go to the latter only.
+func Enqueue(ctx context.Context, tx pgx.Tx, eventType, merchant, userID string, data any) error {
+
+	event := model.Event{
+		ID:        ksuid.New().String(),
+		Type:      eventType,
+		UserID:    userID,
+		Data:      data,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `insert into webhook_deliveries (webhook_id, event_id, event_type, payload)
+		select id, $1, $2, $3 from webhooks where $2 = any(events) and merchant_id in ('', $4)`,
+		event.ID, event.Type, payload, merchant)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Repository) AddWebhook(ctx context.Context, merchant, url, secret string, events []string) (model.Webhook, error) {
+
+	hook := model.Webhook{
+		Merchant: merchant,
+		URL:      url,
+		Secret:   secret,
+		Events:   events,
+	}
+
+	err := p.pool.QueryRow(ctx, `insert into webhooks (merchant_id, url, secret, events) values ($1, $2, $3, $4)
+		returning id, created_time`, merchant, url, secret, events).
+		Scan(&hook.ID, &hook.CreatedAt)
+	if err != nil {
+		return hook, err
+	}
+
+	return hook, nil
+}
+
+func (p *Repository) GetWebhooks(ctx context.Context) ([]model.Webhook, error) {
+
+	rows, err := p.pool.Query(ctx, `select id, merchant_id, url, events, created_time from webhooks order by id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Webhook, 0)
+
+	for rows.Next() {
+
+		var hook model.Webhook
+
+		err = rows.Scan(&hook.ID, &hook.Merchant, &hook.URL, &hook.Events, &hook.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, hook)
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+func (p *Repository) DeleteWebhook(ctx context.Context, ID int64) error {
+
+	tag, err := p.pool.Exec(ctx, `delete from webhooks where id = $1`, ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() < 1 {
+		return model.ErrNotExist
+	}
+
+	return nil
+}
+
+// ClaimDeliveries leases due deliveries to the caller for lease seconds, which
+// must outlast sending them. Rows locked by another dispatcher are skipped,
+// so several replicas may run the dispatcher at once.
+func (p *Repository) ClaimDeliveries(ctx context.Context, limit int, lease float64) ([]model.Delivery, error) {
+
+	rows, err := p.pool.Query(ctx, `
+	update webhook_deliveries d set next_attempt_time = current_timestamp + make_interval(secs => $2)
+	from webhooks w
+	where w.id = d.webhook_id and d.id in (
+		select id from webhook_deliveries
+		where status = 'pending' and next_attempt_time <= current_timestamp
+		order by next_attempt_time limit $1 for update skip locked)
+	returning d.id, d.webhook_id, w.url, w.secret, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.created_time`,
+		limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Delivery, 0)
+
+	for rows.Next() {
+
+		var d model.Delivery
+
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, d)
+	}
+
+	return list, rows.Err()
+}
+
+func (p *Repository) MarkDelivered(ctx context.Context, ID int64) error {
+
+	_, err := p.pool.Exec(ctx, `update webhook_deliveries set status = $1, attempts = attempts + 1, last_error = ''
+		where id = $2`, model.DeliveryDelivered, ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkFailed schedules the next attempt in retryIn seconds, or moves the delivery to the dead-letter state.
+func (p *Repository) MarkFailed(ctx context.Context, ID int64, reason string, retryIn float64, dead bool) error {
+
+	status := model.DeliveryPending
+	if dead {
+		status = model.DeliveryDead
+	}
+
+	_, err := p.pool.Exec(ctx, `update webhook_deliveries set status = $1, attempts = attempts + 1, last_error = $2,
+		next_attempt_time = current_timestamp + make_interval(secs => $3) where id = $4`, status, reason, retryIn, ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (p *Repository) GetDeliveries(ctx context.Context, status string) ([]model.Delivery, error) {
+
+	rows, err := p.pool.Query(ctx, `select id, webhook_id, event_id, event_type, status, attempts, last_error, created_time
+		from webhook_deliveries where $1 = '' or status = $1 order by id desc limit 1000`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := make([]model.Delivery, 0)
+
+	for rows.Next() {
+
+		var d model.Delivery
+
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.LastError, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, d)
+	}
+
+	if len(list) < 1 {
+		return nil, model.ErrNotExist
+	}
+
+	return list, nil
+}
+
+// Redeliver puts a delivered or dead delivery back into the queue with a fresh attempt budget.
+func (p *Repository) Redeliver(ctx context.Context, ID int64) error {
+
+	tag, err := p.pool.Exec(ctx, `update webhook_deliveries set status = $1, attempts = 0, last_error = '',
+		next_attempt_time = current_timestamp where id = $2`, model.DeliveryPending, ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() < 1 {
+		return model.ErrNotExist
+	}
+
+	return nil
+}
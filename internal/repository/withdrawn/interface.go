@@ -8,5 +8,7 @@ import (
 
 type Withdrawn interface {
 	GetWithdrawnOrdersByUserID(ctx context.Context, userID string) ([]model.Withdrawn, error)
+	GetWithdrawnPageByUserID(ctx context.Context, userID string, page model.Page) ([]model.Withdrawn, error)
+	GetWithdrawnSum(ctx context.Context, userID string) (float64, error)
 	AddWithdrawnOrder(ctx context.Context, userID, order, sum string) error
 }
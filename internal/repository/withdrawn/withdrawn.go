@@ -6,8 +6,13 @@ import (
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/events"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/transfers"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/webhooks"
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -17,7 +22,12 @@ type Repository struct {
 
 func NewRepository(cfg config.Config) (*Repository, error) {
 
-	pool := conn.NewConnection(cfg)
+	pool, err := conn.NewConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Pools.Add("withdrawn", pool)
+
 	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
 	defer cancel()
 	if _, err := pool.Exec(ctx, `
@@ -27,6 +37,7 @@ func NewRepository(cfg config.Config) (*Repository, error) {
 		order_accrual text not null,
 		processed_time timestamp not null default current_timestamp
 	);
+	create index if not exists withdrawn_user_id_processed_time_idx on withdrawn (user_id, processed_time);
 `); err != nil {
 		return nil, err
 	}
@@ -38,11 +49,53 @@ func NewRepository(cfg config.Config) (*Repository, error) {
 
 func (p *Repository) GetWithdrawnOrdersByUserID(ctx context.Context, userID string) ([]model.Withdrawn, error) {
 
-	rows, err := p.pool.Query(ctx, `select user_id, order_id, order_accrual, processed_time from withdrawn where user_id=$1`, userID)
+	rows, err := p.pool.Query(ctx, `select user_id, order_id, order_accrual, processed_time from withdrawn where user_id=$1
+		order by processed_time desc, order_id desc`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanWithdrawn(rows)
+}
+
+// GetWithdrawnPageByUserID returns up to page.Limit withdrawals made before the page cursor, newest first;
+// a zero limit returns them all.
+func (p *Repository) GetWithdrawnPageByUserID(ctx context.Context, userID string, page model.Page) ([]model.Withdrawn, error) {
+
+	var rows pgx.Rows
+	var err error
+	if page.After == nil {
+		rows, err = p.pool.Query(ctx, `select user_id, order_id, order_accrual, processed_time from withdrawn where user_id=$1
+			order by processed_time desc, order_id desc limit $2`, userID, page.SQLLimit())
+	} else {
+		rows, err = p.pool.Query(ctx, `select user_id, order_id, order_accrual, processed_time from withdrawn where user_id=$1
+			and (processed_time, order_id) < ($2, $3) order by processed_time desc, order_id desc limit $4`,
+			userID, page.After.Time, page.After.Key, page.SQLLimit())
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	return scanWithdrawn(rows)
+}
+
+// GetWithdrawnSum returns the total the user has withdrawn.
+func (p *Repository) GetWithdrawnSum(ctx context.Context, userID string) (float64, error) {
+
+	sum := 0.0
+	err := p.pool.QueryRow(ctx, `select coalesce(sum(order_accrual::numeric), 0)::float8 from withdrawn where user_id = $1`, userID).
+		Scan(&sum)
+	if err != nil {
+		return 0, err
+	}
+
+	return sum, nil
+}
+
+func scanWithdrawn(rows pgx.Rows) ([]model.Withdrawn, error) {
+
+	defer rows.Close()
+
 	list := make([]model.Withdrawn, 0)
 
 	for rows.Next() {
@@ -50,7 +103,7 @@ func (p *Repository) GetWithdrawnOrdersByUserID(ctx context.Context, userID stri
 		var user, accrual string
 		var order model.Withdrawn
 
-		err = rows.Scan(&user, &order.Order, &accrual, &order.ProcessedAt)
+		err := rows.Scan(&user, &order.Order, &accrual, &order.ProcessedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -73,9 +126,30 @@ func (p *Repository) GetWithdrawnOrdersByUserID(ctx context.Context, userID stri
 	return list, nil
 }
 
+// AddWithdrawnOrder debits the user under transfers.LockBalance,
+// so a withdrawal racing a transfer or another withdrawal can't overdraw the balance.
 func (p *Repository) AddWithdrawnOrder(ctx context.Context, userID, order, sum string) error {
 
-	_, err := p.pool.Exec(ctx, `insert into withdrawn (user_id, order_id, order_accrual) values ($1, $2, $3)`, userID, order, sum)
+	amount, err := strconv.ParseFloat(sum, 64)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	balance, err := transfers.LockBalance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if balance < amount {
+		return model.ErrInsufficientFunds
+	}
+
+	_, err = tx.Exec(ctx, `insert into withdrawn (user_id, order_id, order_accrual) values ($1, $2, $3)`, userID, order, sum)
 	if err != nil {
 		pgerr, ok := err.(*pgconn.PgError)
 		if ok {
@@ -87,5 +161,24 @@ func (p *Repository) AddWithdrawnOrder(ctx context.Context, userID, order, sum s
 		return err
 	}
 
+	err = events.RecordBalance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = webhooks.Enqueue(ctx, tx, model.EventWithdrawalCreated, "", userID, model.WriteOff{
+		Order: order,
+		Sum:   amount,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	metrics.PointsWithdrawn.Add(amount)
+
 	return nil
 }
@@ -7,20 +7,36 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/health"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/tracing"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Loop polls the accrual system for pending orders. When the accrual system
+// pushes results to the callback, polling only reconciles missed callbacks.
 func Loop(ctx context.Context, rep repository.Pool, cfg config.Config, logger logging.Logger) {
 
-	ticker := time.NewTicker(time.Millisecond * 100)
+	interval := cfg.ScanInterval
+	if cfg.AccrualCallbackSecret != "" {
+		interval = cfg.ReconcileInterval
+	}
+
+	health.Beat()
+	ticker := time.NewTicker(interval)
 	for {
 		select {
 		case <-ticker.C:
+			health.Beat()
 			scanner(rep, cfg, logger)
 		case <-ctx.Done():
 			logger.Info("Loop stopped")
@@ -34,44 +50,124 @@ func scanner(rep repository.Pool, cfg config.Config, logger logging.Logger) {
 	list, err := rep.Orders.GetOrdersForScanner()
 	if err != nil {
 		logger.Printf("scanner:%v", err)
+	} else {
+		metrics.ScannerBacklog.Set(float64(len(list)))
 	}
 
 	if len(list) < 1 {
 		return
 	}
 
-	for _, order := range list {
-		dur, err := updateOrders(rep, cfg, order.Number)
-		if err != nil {
-			if errors.Is(err, model.Err409) {
-				time.Sleep(dur)
-				continue
-			} else {
-				return
+	addresses := accrualAddresses(rep, cfg, logger)
+
+	workers := cfg.ScanWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	// any error but 429 stops the scan until the next tick
+	stop := make(chan struct{})
+	var once sync.Once
+
+	orders := make(chan model.Order)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for order := range orders {
+				health.Beat()
+				dur, err := updateOrders(rep, cfg, addresses(order.Merchant), order)
+				if err != nil {
+					if errors.Is(err, model.Err409) {
+						time.Sleep(dur)
+						continue
+					} else {
+						logger.Printf("scanner:%v", err)
+						once.Do(func() { close(stop) })
+					}
+				}
 			}
+		}()
+	}
+
+feed:
+	for _, order := range list {
+		select {
+		case orders <- order:
+		case <-stop:
+			break feed
+		}
+	}
+	close(orders)
+	wg.Wait()
+}
+
+// accrualAddresses maps merchants to their accrual system, the one of cfg
+// being the default. The merchants are read once per scan.
+func accrualAddresses(rep repository.Pool, cfg config.Config, logger logging.Logger) func(merchant string) string {
+
+	ctx, cancel := context.WithTimeout(context.Background(), model.TimeOut)
+	defer cancel()
+
+	addresses := make(map[string]string)
+	list, err := rep.Merchants.GetMerchants(ctx)
+	if err != nil && !errors.Is(err, model.ErrNotExist) {
+		logger.Printf("scanner:%v", err)
+	}
+	for _, m := range list {
+		if m.AccrualAddress != "" {
+			addresses[m.ID] = m.AccrualAddress
+		}
+	}
+
+	return func(merchant string) string {
+		if address, ok := addresses[merchant]; ok {
+			return address
 		}
+		return cfg.AccrualSystemAddress
 	}
 }
 
-func updateOrders(rep repository.Pool, cfg config.Config, order string) (time.Duration, error) {
+func updateOrders(rep repository.Pool, cfg config.Config, address string, order model.Order) (time.Duration, error) {
 
-	ctx, cansel := context.WithTimeout(context.Background(), model.TimeOut)
+	ctx, cansel := context.WithTimeout(context.Background(), cfg.AccrualTimeout)
 	defer cansel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.AccrualSystemAddress+"/api/orders/"+order, nil)
+	ctx, span := tracing.Start(ctx, "GET /api/orders/{number}", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("order.number", order.Number), attribute.String("order.merchant", order.Merchant)))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+"/api/orders/"+order.Number, nil)
 	if err != nil {
 		return 0, err
 	}
+	tracing.Inject(ctx, req.Header)
+
+	metrics.ScannerPolls.Inc()
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		metrics.AccrualResponses.WithLabelValues("error").Inc()
+		tracing.Fail(span, err)
 		return 0, err
 	}
 	defer resp.Body.Close()
+	metrics.AccrualResponse(resp.StatusCode)
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
 
 	if resp.StatusCode == http.StatusNoContent {
 		return 0, nil
 	}
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t := resp.Header.Get("Retry-After")
+		dur, err := time.ParseDuration(t)
+		if err != nil {
+			dur = model.TimeOut
+		}
+		return dur, model.Err409
+	}
+
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return 0, err
@@ -82,20 +178,31 @@ func updateOrders(rep repository.Pool, cfg config.Config, order string) (time.Du
 	if err != nil {
 		return 0, err
 	}
+	// the accrual system knows nothing of our merchant IDs
+	data.Merchant = order.Merchant
 
-	err = rep.Orders.UpdateOrderData(ctx, data.Status, fmt.Sprintf("%g", data.Accrual), data.Order)
+	// on an error the order stays pending and is polled again
+	err = Apply(ctx, rep, data)
 	if err != nil {
-		return 0, nil
+		return 0, fmt.Errorf("order %s: %w", order.Number, err)
 	}
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		t := resp.Header.Get("Retry-After")
-		dur, err := time.ParseDuration(t)
-		if err != nil {
-			dur = model.TimeOut
-		}
-		return dur, model.Err409
+	return 0, nil
+}
+
+var accrualStatuses = map[string]bool{
+	"REGISTERED": true,
+	"INVALID":    true,
+	"PROCESSING": true,
+	"PROCESSED":  true,
+}
+
+// Apply stores a result of the accrual system, whether it was polled or pushed.
+func Apply(ctx context.Context, rep repository.Pool, data model.ResponseForScanner) error {
+
+	if !accrualStatuses[data.Status] {
+		return model.ErrBadStatus
 	}
 
-	return 0, nil
+	return rep.Orders.UpdateOrderData(ctx, data.Merchant, data.Status, model.FormatSum(data.Accrual), data.Order)
 }
@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+)
+
+func TestUpdateOrders(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		code    int
+		body    string
+		want    error
+		pending bool
+	}{
+		{name: "processed", code: http.StatusOK, body: `{"order":"12345678903","status":"PROCESSED","accrual":50}`},
+		{name: "unknown status", code: http.StatusOK, body: `{"order":"12345678903","status":"DONE"}`, want: model.ErrBadStatus, pending: true},
+		{name: "unknown order", code: http.StatusOK, body: `{"order":"79927398713","status":"PROCESSED"}`, want: model.ErrNotExist, pending: true},
+		{name: "not registered", code: http.StatusNoContent, pending: true},
+		{name: "too many requests", code: http.StatusTooManyRequests, body: "No more than N requests per minute allowed", want: model.Err409, pending: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctx := context.Background()
+			rep := repository.NewMemoryReps()
+			if err := rep.Orders.AddOrder(ctx, "u1", "", "12345678903"); err != nil {
+				t.Fatalf("AddOrder: %v", err)
+			}
+
+			accrual := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "1s")
+				w.WriteHeader(tt.code)
+				w.Write([]byte(tt.body))
+			}))
+			defer accrual.Close()
+
+			_, err := updateOrders(*rep, config.Default(), accrual.URL, model.Order{Number: "12345678903"})
+			if tt.want == nil && err != nil {
+				t.Fatalf("updateOrders: %v", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("updateOrders = %v, want %v", err, tt.want)
+			}
+
+			list, _ := rep.Orders.GetOrdersForScanner()
+			if pending := len(list) == 1; pending != tt.pending {
+				t.Errorf("order pending = %v, want %v", pending, tt.pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/conn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/handlers"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/ratelimit"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// limits are the rate limit middlewares of the user API. They share one
+// limiter, so the versions and aliases of a route share their buckets too.
+type limits struct {
+	ip     func(http.Handler) http.Handler
+	user   func(http.Handler) http.Handler
+	auth   func(http.Handler) http.Handler
+	orders func(http.Handler) http.Handler
+}
+
+func newLimits(cfg config.Config, logger logging.Logger) (limits, error) {
+
+	var limiter ratelimit.Limiter
+	switch cfg.RateLimitStore {
+	case ratelimit.StorePostgres:
+		pool, err := conn.NewConnection(cfg)
+		if err != nil {
+			return limits{}, err
+		}
+		metrics.Pools.Add("ratelimit", pool)
+		limiter, err = ratelimit.NewPostgres(pool)
+		if err != nil {
+			return limits{}, err
+		}
+	default:
+		limiter = ratelimit.NewMemory()
+	}
+
+	policies := make(map[string]ratelimit.Policy)
+	for name, spec := range map[string]string{
+		"ip":     cfg.RateLimitIP,
+		"user":   cfg.RateLimitUser,
+		"auth":   cfg.RateLimitAuth,
+		"orders": cfg.RateLimitOrders,
+	} {
+		p, err := ratelimit.ParsePolicy(name, spec)
+		if err != nil {
+			return limits{}, err
+		}
+		policies[name] = p
+	}
+
+	clientIP := handlers.ClientIP(cfg.ClientIPHeader)
+
+	return limits{
+		ip:     handlers.RateLimit(limiter, policies["ip"], clientIP, logger),
+		user:   handlers.RateLimit(limiter, policies["user"], handlers.UserID, logger),
+		auth:   handlers.RateLimit(limiter, policies["auth"], clientIP, logger),
+		orders: handlers.RateLimit(limiter, policies["orders"], handlers.UserID, logger),
+	}, nil
+}
@@ -1,46 +1,241 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/api/openapi"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/broker"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/handlers"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/health"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/metrics"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/service"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/tracing"
 	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 )
 
-func StartServer(rep repository.Pool, cfg config.Config, logger logging.Logger) error {
+// StartServer serves the API until ctx is done. It then reports not ready for
+// cfg.ShutdownDelay, so load balancers stop sending requests, and lets the
+// requests in flight finish. With a certificate configured it serves HTTPS,
+// and HTTP/2 along with it.
+func StartServer(ctx context.Context, rep repository.Pool, hub *broker.Hub, validators *service.Validators, cfg config.Config, logger logging.Logger) error {
+
+	srv := &http.Server{
+		Addr:              cfg.RunAddress,
+		Handler:           NewRouter(rep, hub, validators, cfg, logger),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	if cfg.TLSCertFile != "" {
+		tc, err := TLSConfig(cfg, logger)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tc
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+
+		health.ShutDown()
+		logger.Info("shutting down")
+		time.Sleep(cfg.ShutdownDelay)
+
+		sctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		err := srv.Shutdown(sctx)
+		if err != nil {
+			logger.Error("Shutdown: ", err)
+			srv.Close()
+		}
+	}()
+
+	var err error
+	if srv.TLSConfig != nil {
+		logger.Info("server running with TLS")
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		logger.Info("server running")
+		err = srv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-done
+
+	return nil
+}
+
+// StartMetricsServer serves /metrics on the admin listener, apart from the API.
+func StartMetricsServer(cfg config.Config, logger logging.Logger) error {
 
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	srv := &http.Server{
+		Addr:              cfg.MetricsAddress,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	logger.Info("metrics server running")
+	return srv.ListenAndServe()
+}
+
+// NewRouter builds the complete HTTP API, so it can be served by httptest as well.
+func NewRouter(rep repository.Pool, hub *broker.Hub, validators *service.Validators, cfg config.Config, logger logging.Logger) chi.Router {
+
+	v1, err := openapi.Load(openapi.Spec)
+	if err != nil {
+		logger.Fatal("openapi.Load: ", err)
+	}
+	v2, err := openapi.Load(openapi.SpecV2)
+	if err != nil {
+		logger.Fatal("openapi.Load: ", err)
+	}
+
+	sunset := time.Time{}
+	if cfg.V1Sunset != "" {
+		sunset, err = time.Parse("2006-01-02", cfg.V1Sunset)
+		if err != nil {
+			logger.Fatal("API_V1_SUNSET: ", err)
+		}
+	}
+	deprecated := handlers.Deprecated(handlers.V1Deprecated, sunset, "/api/v2/user")
+
+	limit, err := newLimits(cfg, logger)
+	if err != nil {
+		logger.Fatal("rate limits: ", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Use(metrics.Middleware)
+	r.Use(middleware.RequestID)
+	r.Use(handlers.RequestID)
+	r.Use(handlers.AccessLog(logger))
 	r.Use(middleware.Recoverer)
-	r.Use(handlers.GzipRequest)
-	r.Use(handlers.GzipResponse)
+	r.Use(handlers.Decompress(cfg.MaxDecompressedBytes))
+	r.Use(handlers.Compress(compressTypes(cfg.CompressTypes), cfg.CompressMinSize))
 
-	r.Route("/api/user", func(r chi.Router) {
+	r.NotFound(handlers.NotFound)
+	r.MethodNotAllowed(handlers.MethodNotAllowed)
 
-		r.Post("/register", handlers.RegisterHandler(rep, cfg, logger))
-		r.Post("/login", handlers.LoginHandler(rep, cfg, logger))
+	r.Get("/healthz", handlers.HealthzHandler)
+	r.Get("/readyz", handlers.ReadyzHandler(health.NewChecker(rep, cfg), logger))
+
+	r.Get("/api/openapi.json", handlers.OpenAPIHandler(openapi.Spec))
+	r.Get("/api/v2/openapi.json", handlers.OpenAPIHandler(openapi.SpecV2))
+	if cfg.SwaggerUI {
+		r.Get("/api/docs", handlers.SwaggerUIHandler(cfg.SwaggerUIAssets))
+	}
 
-		r.Group(func(r chi.Router) {
-			r.Use(handlers.Auth(cfg, logger))
+	// /api/user is the original v1 path, /api/v1/user its versioned alias
+	r.Mount("/api/user", userRoutes(rep, hub, validators, cfg, logger, limit, handlers.V1, v1, "/api/user", deprecated))
+	r.Mount("/api/v1/user", userRoutes(rep, hub, validators, cfg, logger, limit, handlers.V1, v1, "/api/user", deprecated))
+	r.Mount("/api/v2/user", userRoutes(rep, hub, validators, cfg, logger, limit, handlers.V2, v2, "/api/v2/user"))
 
-			r.Post("/orders", handlers.PostOrdersHandler(rep, cfg, logger))
-			r.Get("/orders", handlers.GetOrdersHandler(rep, cfg, logger))
-			r.Get("/balance", handlers.BalanceHandler(rep, cfg, logger))
-			r.Post("/balance/withdraw", handlers.PostWithdrawHandler(rep, cfg, logger))
-			r.Get("/withdrawals", handlers.GetWithdrawalsHandler(rep, cfg, logger))
-			r.Get("/ping", handlers.PingDataBase(rep, logger))
-		})
+	r.Route("/api/internal", func(r chi.Router) {
+		r.Use(handlers.MaxBody(cfg.MaxBodyBytes, nil))
+		r.Use(handlers.AccrualAuth(cfg, logger))
+
+		r.Post("/accrual/callback", handlers.AccrualCallbackHandler(rep, logger))
+		r.Post("/accrual/merchants/{merchant}/callback", handlers.AccrualCallbackHandler(rep, logger))
 	})
 
-	logger.Info("server running")
-	err := http.ListenAndServe(cfg.RunAddress, r)
-	if err != nil {
-		logger.Fatal("ListenAndServe: ", err)
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(handlers.MaxBody(cfg.MaxBodyBytes, nil))
+		r.Use(handlers.AdminAuth(cfg, logger))
+
+		r.Put("/transfers", handlers.TransfersSwitchHandler(rep, logger))
+		r.Post("/users/{login}/adjustments", handlers.AdjustmentHandler(rep, cfg, logger))
+		r.Post("/users/{login}/withdrawals/{order}/reversal", handlers.ReversalHandler(rep, cfg, logger))
+
+		r.Post("/merchants", handlers.AddMerchantHandler(rep, validators, logger))
+		r.Get("/merchants", handlers.GetMerchantsHandler(rep, validators, logger))
+		r.Get("/merchants/{id}", handlers.GetMerchantHandler(rep, validators, logger))
+		r.Put("/merchants/{id}", handlers.UpdateMerchantHandler(rep, validators, logger))
+		r.Get("/merchants/{id}/report", handlers.MerchantReportHandler(rep, validators, logger))
+
+		r.Post("/webhooks", handlers.AddWebhookHandler(rep, logger))
+		r.Get("/webhooks", handlers.GetWebhooksHandler(rep, logger))
+		r.Delete("/webhooks/{id}", handlers.DeleteWebhookHandler(rep, logger))
+		r.Get("/webhooks/deliveries", handlers.GetDeliveriesHandler(rep, logger))
+		r.Post("/webhooks/deliveries/{id}/redeliver", handlers.RedeliverHandler(rep, logger))
+	})
+
+	return r
+}
+
+// userRoutes builds the user API in the given version. base is where the
+// version's OpenAPI document places these routes.
+func userRoutes(rep repository.Pool, hub *broker.Hub, validators *service.Validators, cfg config.Config, logger logging.Logger, limit limits,
+	v handlers.Version, doc *openapi.Document, base string, middlewares ...func(http.Handler) http.Handler) chi.Router {
+
+	r := chi.NewRouter()
+	r.Use(middlewares...)
+	r.Use(handlers.APIVersion(v))
+	r.Use(limit.ip)
+
+	body := []func(http.Handler) http.Handler{
+		handlers.MaxBody(cfg.MaxBodyBytes, map[string]int64{"/orders/batch": cfg.BatchMaxBodyBytes}),
+		handlers.ValidateRequest(doc, base, logger),
 	}
 
-	return nil
+	r.Group(func(r chi.Router) {
+		r.Use(body...)
+
+		r.With(limit.auth).Post("/register", handlers.RegisterHandler(rep, cfg, logger))
+		r.With(limit.auth).Post("/login", handlers.LoginHandler(rep, cfg, logger))
+	})
+
+	// authenticate before the body is validated, so a caller without a token
+	// gets 401 whatever it sends
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.Auth(cfg, logger))
+		r.Use(limit.user)
+		r.Use(body...)
+
+		r.With(limit.orders).Post("/orders", handlers.PostOrdersHandler(rep, validators, cfg, logger))
+		r.With(limit.orders).Post("/orders/batch", handlers.PostOrdersBatchHandler(rep, validators, cfg, logger))
+		r.Get("/orders", handlers.GetOrdersHandler(rep, validators, cfg, logger))
+		r.Get("/balance", handlers.BalanceHandler(rep, cfg, logger))
+		r.Post("/balance/withdraw", handlers.PostWithdrawHandler(rep, cfg, logger))
+		r.Post("/balance/transfer", handlers.PostTransferHandler(rep, cfg, logger))
+		r.Get("/withdrawals", handlers.GetWithdrawalsHandler(rep, cfg, logger))
+		r.Get("/transfers", handlers.GetTransfersHandler(rep, cfg, logger))
+		r.Get("/transactions", handlers.GetTransactionsHandler(rep, cfg, logger))
+		r.Get("/events", handlers.EventsHandler(rep, hub, cfg, logger))
+		r.Get("/ping", handlers.PingDataBase(rep, logger))
+	})
+
+	return r
+}
+
+// compressTypes splits the COMPRESS_TYPES list.
+func compressTypes(list string) []string {
+
+	types := make([]string, 0)
+	for _, t := range strings.Split(list, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	return types
 }
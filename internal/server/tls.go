@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/cmd/config"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/logging"
+)
+
+// certCheckInterval is how often handshakes look at the certificate files.
+const certCheckInterval = 10 * time.Second
+
+// certReloader serves the certificate from its files and reloads it when
+// either file changes, so a renewed certificate is picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   logging.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger logging.Logger) (*certReloader, error) {
+
+	c := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	err := c.reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// modified returns the later modification time of the two files.
+func (c *certReloader) modified() (time.Time, error) {
+
+	cert, err := os.Stat(c.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	key, err := os.Stat(c.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if key.ModTime().After(cert.ModTime()) {
+		return key.ModTime(), nil
+	}
+
+	return cert.ModTime(), nil
+}
+
+func (c *certReloader) reload() error {
+
+	modTime, err := c.modified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.cert = &cert
+	c.modTime = modTime
+	c.checked = time.Now()
+
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. When the new files
+// can't be loaded, say they are half written, the old certificate is served.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a handshake stats the files at most once per interval
+	if time.Since(c.checked) < certCheckInterval {
+		return c.cert, nil
+	}
+	c.checked = time.Now()
+
+	modTime, err := c.modified()
+	if err == nil && !modTime.Equal(c.modTime) {
+		err = c.reload()
+		if err == nil {
+			c.logger.Info("TLS certificate reloaded")
+		}
+	}
+	if err != nil {
+		c.logger.Error("TLS certificate reload: ", err)
+	}
+
+	return c.cert, nil
+}
+
+// TLSConfig builds the TLS config of the HTTP and gRPC APIs. Client certificates
+// are optional: only the accrual system callback accepts them instead of a signature.
+func TLSConfig(cfg config.Config, logger logging.Logger) (*tls.Config, error) {
+
+	certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	if cfg.TLSClientCAFile != "" {
+		b, err := os.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no certificates in " + cfg.TLSClientCAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tc, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/authjwt"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/users"
+	"github.com/segmentio/ksuid"
+)
+
+type AuthService struct {
+	users users.Users
+	key   string
+	ttl   time.Duration
+}
+
+func NewAuthService(u users.Users, key string, ttl time.Duration) *AuthService {
+	return &AuthService{
+		users: u,
+		key:   key,
+		ttl:   ttl,
+	}
+}
+
+// Register creates the user and returns a token for it.
+func (s *AuthService) Register(ctx context.Context, login, pass string) (string, error) {
+
+	v := ValidationError{}
+	v.check(login != "", "login", "is required")
+	v.check(pass != "", "password", "is required")
+	if err := v.err(); err != nil {
+		return "", err
+	}
+
+	//generate new user ID
+	ID := ksuid.New().String()
+
+	err := s.users.AddUserAuthData(ctx, login, pass, ID)
+	if err != nil {
+		if errors.Is(err, model.ErrConflict) {
+			return "", ErrLoginTaken
+		}
+		return "", err
+	}
+
+	return authjwt.EncodeJWT(ID, s.key, s.ttl)
+}
+
+func (s *AuthService) Login(ctx context.Context, login, pass string) (string, error) {
+
+	ID, err := s.users.GetUserAuthData(ctx, login, pass)
+	if err != nil {
+		if errors.Is(err, model.ErrNotExist) || errors.Is(err, model.ErrWrongPass) {
+			return "", ErrBadCredentials
+		}
+		return "", err
+	}
+
+	return authjwt.EncodeJWT(ID, s.key, s.ttl)
+}
+
+// Authenticate returns the user ID of a valid token.
+func (s *AuthService) Authenticate(token string) (string, error) {
+
+	if token == "" {
+		return "", ErrUnauthorized
+	}
+
+	ID, err := authjwt.ValidateJWT(token, s.key)
+	if err != nil {
+		return "", ErrUnauthorized
+	}
+
+	return ID, nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/adjustments"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/orders"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/transfers"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/users"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/withdrawn"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
+)
+
+type BalanceService struct {
+	orders     orders.Orders
+	withdrawn  withdrawn.Withdrawn
+	transfers  transfers.Transfers
+	adjusted   adjustments.Adjustments
+	users      users.Users
+	dailyLimit float64
+}
+
+func NewBalanceService(o orders.Orders, w withdrawn.Withdrawn, t transfers.Transfers, a adjustments.Adjustments,
+	u users.Users, dailyLimit float64) *BalanceService {
+	return &BalanceService{
+		orders:     o,
+		withdrawn:  w,
+		transfers:  t,
+		adjusted:   a,
+		users:      u,
+		dailyLimit: dailyLimit,
+	}
+}
+
+// Balance sums accruals, transfers and adjustments minus withdrawals. The repositories do the sums.
+func (s *BalanceService) Balance(ctx context.Context, userID string) (model.Response, error) {
+
+	current, err := s.orders.GetAccrualSum(ctx, userID)
+	if err != nil {
+		return model.Response{}, err
+	}
+
+	withdrawn, err := s.withdrawn.GetWithdrawnSum(ctx, userID)
+	if err != nil {
+		return model.Response{}, err
+	}
+
+	transferred, err := s.transfers.GetTransfersBalance(ctx, userID)
+	if err != nil {
+		return model.Response{}, err
+	}
+	current += transferred
+
+	adjusted, err := s.adjusted.GetAdjustmentsBalance(ctx, userID)
+	if err != nil {
+		return model.Response{}, err
+	}
+	current += adjusted
+
+	return model.Response{
+		Current:   current - withdrawn,
+		Withdrawn: withdrawn,
+	}, nil
+}
+
+func (s *BalanceService) Withdraw(ctx context.Context, userID, order string, sum float64) error {
+
+	// a negative sum would credit the balance
+	v := ValidationError{}
+	v.check(sum > 0, "sum", "must be positive")
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	if err := checkNumber(validation.Luhn{}, order); err != nil {
+		return ErrInvalidOrder
+	}
+
+	// the repository checks the balance under the same lock as transfers
+	return s.withdrawn.AddWithdrawnOrder(ctx, userID, order, model.FormatSum(sum))
+}
+
+// Withdrawals returns the user's withdrawals, newest first, paged like OrderService.List.
+func (s *BalanceService) Withdrawals(ctx context.Context, userID string, page model.Page) ([]model.Withdrawn, *model.Cursor, error) {
+
+	if page.Limit < 1 {
+		list, err := s.withdrawn.GetWithdrawnOrdersByUserID(ctx, userID)
+		return list, nil, err
+	}
+
+	// one extra row tells whether there is a next page
+	page.Limit++
+	list, err := s.withdrawn.GetWithdrawnPageByUserID(ctx, userID, page)
+	page.Limit--
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(list) > page.Limit {
+		list = list[:page.Limit]
+		last := list[page.Limit-1]
+		return list, &model.Cursor{Time: last.ProcessedAt, Key: last.Order}, nil
+	}
+
+	return list, nil, nil
+}
+
+func (s *BalanceService) Transfer(ctx context.Context, userID, recipient string, sum float64) error {
+
+	v := ValidationError{}
+	v.check(recipient != "", "recipient", "is required")
+	v.check(sum > 0, "sum", "must be positive")
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	enabled, err := s.transfers.Enabled(ctx)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTransfersDisabled
+	}
+
+	recipientID, err := s.users.GetUserIDByLogin(ctx, recipient)
+	if err != nil {
+		if errors.Is(err, model.ErrNotExist) {
+			return ErrUnknownRecipient
+		}
+		return err
+	}
+	if recipientID == userID {
+		return ErrSelfTransfer
+	}
+
+	return s.transfers.AddTransfer(ctx, userID, recipientID, model.FormatSum(sum), s.dailyLimit)
+}
+
+// Adjust corrects the balance of the user by login: a positive sum credits it, a negative one debits it.
+func (s *BalanceService) Adjust(ctx context.Context, login, reference string, sum float64) error {
+
+	v := ValidationError{}
+	v.check(strings.TrimSpace(reference) != "", "reference", "is required")
+	v.check(sum != 0, "sum", "must not be zero")
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	userID, err := s.userID(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	return s.adjusted.AddAdjustment(ctx, userID, reference, model.FormatSum(sum))
+}
+
+// Reverse returns the points of the user's withdrawal to the order back to the balance.
+func (s *BalanceService) Reverse(ctx context.Context, login, order string) error {
+
+	userID, err := s.userID(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	err = s.adjusted.ReverseWithdrawal(ctx, userID, order)
+	if errors.Is(err, model.ErrNotExist) {
+		return ErrUnknownWithdrawal
+	}
+	if errors.Is(err, model.ErrConflict) {
+		return ErrAlreadyReversed
+	}
+
+	return err
+}
+
+func (s *BalanceService) userID(ctx context.Context, login string) (string, error) {
+
+	userID, err := s.users.GetUserIDByLogin(ctx, login)
+	if errors.Is(err, model.ErrNotExist) {
+		return "", ErrUnknownUser
+	}
+
+	return userID, err
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository"
+)
+
+func TestWithdrawSum(t *testing.T) {
+
+	ctx := context.Background()
+	rep := repository.NewMemoryReps()
+	s := NewBalanceService(rep.Orders, rep.Withdrawn, rep.Transfers, rep.Adjustments, rep.Users, 0)
+
+	if err := rep.Orders.AddOrder(ctx, "u1", "", "12345678903"); err != nil {
+		t.Fatalf("AddOrder: %v", err)
+	}
+	if err := rep.Orders.UpdateOrderData(ctx, "", "PROCESSED", "100", "12345678903"); err != nil {
+		t.Fatalf("UpdateOrderData: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		sum  float64
+		want error
+	}{
+		{name: "negative", sum: -500, want: ErrBadRequest},
+		{name: "zero", sum: 0, want: ErrBadRequest},
+		{name: "past the balance", sum: 100.01, want: model.ErrInsufficientFunds},
+		{name: "positive", sum: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Withdraw(ctx, "u1", "79927398713", tt.sum)
+			if tt.want == nil && err != nil {
+				t.Fatalf("Withdraw(%v): %v", tt.sum, err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Withdraw(%v) = %v, want %v", tt.sum, err, tt.want)
+			}
+		})
+	}
+
+	balance, err := s.Balance(ctx, "u1")
+	if err != nil || balance.Current != 60 || balance.Withdrawn != 40 {
+		t.Errorf("Balance after withdrawals: got %+v, %v", balance, err)
+	}
+}
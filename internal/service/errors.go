@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+)
+
+var (
+	ErrBadRequest        = errors.New("bad request")
+	ErrBadOrderNumber    = errors.New("bad order number")
+	ErrInvalidOrder      = errors.New("invalid order number")
+	ErrOrderConflict     = errors.New("order was uploaded by another user")
+	ErrUnknownMerchant   = errors.New("unknown merchant")
+	ErrMerchantExists    = errors.New("merchant exists")
+	ErrLoginTaken        = errors.New("login is taken")
+	ErrBadCredentials    = errors.New("wrong login or password")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrUnknownRecipient  = errors.New("unknown recipient")
+	ErrUnknownUser       = errors.New("unknown user")
+	ErrUnknownWithdrawal = errors.New("unknown withdrawal")
+	ErrAlreadyReversed   = errors.New("withdrawal is reversed already")
+
+	// the repositories refuse these too, as a transfer is stored
+	ErrSelfTransfer      = model.ErrSelfTransfer
+	ErrTransfersDisabled = model.ErrTransfersDisabled
+)
+
+// FieldError names a request field and why it was rejected.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// ValidationError lists every invalid field. It matches ErrBadRequest with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+
+	msg := ErrBadRequest.Error() + ":"
+	for _, f := range e.Fields {
+		msg += " " + f.Field + " " + f.Reason + ";"
+	}
+
+	return msg
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrBadRequest
+}
+
+// check collects a field error when ok is false.
+func (e *ValidationError) check(ok bool, field, reason string) {
+	if !ok {
+		e.Fields = append(e.Fields, FieldError{Field: field, Reason: reason})
+	}
+}
+
+// err returns nil when all fields passed.
+func (e *ValidationError) err() error {
+	if len(e.Fields) < 1 {
+		return nil
+	}
+	return e
+}
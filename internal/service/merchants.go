@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/merchants"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
+)
+
+// merchantID keeps merchant IDs usable in query strings and validator specs.
+var merchantID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+type MerchantService struct {
+	merchants  merchants.Merchants
+	validators *Validators
+}
+
+// NewMerchantService drops the merchants it updates from validators.
+func NewMerchantService(m merchants.Merchants, validators *Validators) *MerchantService {
+	return &MerchantService{
+		merchants:  m,
+		validators: validators,
+	}
+}
+
+func checkMerchant(merchant model.Merchant) error {
+
+	v := ValidationError{}
+	v.check(merchantID.MatchString(merchant.ID), "id", "must be 1 to 64 lower-case letters, digits, - and _")
+	v.check(strings.TrimSpace(merchant.Name) != "", "name", "is required")
+	if merchant.AccrualAddress != "" {
+		u, err := url.Parse(merchant.AccrualAddress)
+		v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"accrual_address", "must be an absolute http or https URL")
+	}
+	if merchant.Validator != "" {
+		_, err := validation.ParseValidator(merchant.Validator)
+		if err != nil {
+			v.check(false, "validator", err.Error())
+		}
+	}
+
+	return v.err()
+}
+
+// Add registers the merchant. Its ID is final: orders are keyed by it.
+func (s *MerchantService) Add(ctx context.Context, merchant model.Merchant) (model.Merchant, error) {
+
+	err := checkMerchant(merchant)
+	if err != nil {
+		return model.Merchant{}, err
+	}
+
+	merchant.AccrualAddress = strings.TrimSuffix(merchant.AccrualAddress, "/")
+	merchant, err = s.merchants.AddMerchant(ctx, merchant)
+	if errors.Is(err, model.ErrConflict) {
+		return model.Merchant{}, ErrMerchantExists
+	}
+
+	return merchant, err
+}
+
+// Update replaces the name, accrual address and validator of the merchant.
+func (s *MerchantService) Update(ctx context.Context, merchant model.Merchant) (model.Merchant, error) {
+
+	err := checkMerchant(merchant)
+	if err != nil {
+		return model.Merchant{}, err
+	}
+
+	merchant.AccrualAddress = strings.TrimSuffix(merchant.AccrualAddress, "/")
+	merchant, err = s.merchants.UpdateMerchant(ctx, merchant)
+	if errors.Is(err, model.ErrNotExist) {
+		return model.Merchant{}, ErrUnknownMerchant
+	}
+	if err == nil {
+		s.validators.Forget(merchant.ID)
+	}
+
+	return merchant, err
+}
+
+func (s *MerchantService) Get(ctx context.Context, ID string) (model.Merchant, error) {
+
+	merchant, err := s.merchants.GetMerchant(ctx, ID)
+	if errors.Is(err, model.ErrNotExist) {
+		return model.Merchant{}, ErrUnknownMerchant
+	}
+
+	return merchant, err
+}
+
+// List returns every merchant by ID; model.ErrNotExist when there are none.
+func (s *MerchantService) List(ctx context.Context) ([]model.Merchant, error) {
+	return s.merchants.GetMerchants(ctx)
+}
+
+// Report sums up the orders of the merchant uploaded within [from, to).
+func (s *MerchantService) Report(ctx context.Context, ID string, from, to time.Time) (model.MerchantReport, error) {
+
+	report, err := s.merchants.GetReport(ctx, ID, from, to)
+	if errors.Is(err, model.ErrNotExist) {
+		return model.MerchantReport{}, ErrUnknownMerchant
+	}
+
+	return report, err
+}
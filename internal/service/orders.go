@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/orders"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
+)
+
+type OrderService struct {
+	orders     orders.Orders
+	validators *Validators
+}
+
+// NewOrderService validates order numbers with the validator of their
+// merchant, see Validators.
+func NewOrderService(o orders.Orders, validators *Validators) *OrderService {
+	return &OrderService{
+		orders:     o,
+		validators: validators,
+	}
+}
+
+// checkNumber returns ErrBadOrderNumber for a malformed number and
+// ErrInvalidOrder, wrapping the validation.CheckError, for an invalid one.
+func checkNumber(v validation.Validator, number string) error {
+
+	err := v.Validate(number)
+	if errors.Is(err, validation.ErrFormat) {
+		return ErrBadOrderNumber
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+
+	return nil
+}
+
+// Upload registers the order for the user, validated by the rules of the
+// merchant. It reports false when the user has already uploaded this order.
+func (s *OrderService) Upload(ctx context.Context, userID, merchant, number string) (bool, error) {
+
+	v, err := s.validators.For(ctx, merchant)
+	if err != nil {
+		return false, err
+	}
+
+	err = checkNumber(v, number)
+	if err != nil {
+		return false, err
+	}
+
+	user, err := s.orders.GetUserIDbyOrder(ctx, merchant, number)
+	if errors.Is(err, model.ErrNotExist) {
+		err = s.orders.AddOrder(ctx, userID, merchant, number)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, model.ErrConflict) {
+			return false, err
+		}
+		// uploaded concurrently, look up who won
+		user, err = s.orders.GetUserIDbyOrder(ctx, merchant, number)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if user != userID {
+		return false, ErrOrderConflict
+	}
+
+	return false, nil
+}
+
+// UploadBatch validates every number by the rules of the merchant and inserts the valid ones at once.
+func (s *OrderService) UploadBatch(ctx context.Context, userID, merchant string, numbers []string) ([]model.BatchResult, error) {
+
+	v, err := s.validators.For(ctx, merchant)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]model.BatchResult, len(numbers))
+	valid := make([]string, 0, len(numbers))
+	for i, number := range numbers {
+		results[i].Number = number
+		err := checkNumber(v, number)
+		if errors.Is(err, ErrBadOrderNumber) {
+			results[i].Status = model.BatchBadFormat
+			continue
+		}
+		if errors.Is(err, ErrInvalidOrder) {
+			results[i].Status = model.BatchInvalid
+			continue
+		}
+		valid = append(valid, number)
+	}
+
+	if len(valid) < 1 {
+		return results, nil
+	}
+
+	inserted, owners, err := s.orders.AddOrders(ctx, userID, merchant, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		number := results[i].Number
+		if results[i].Status != "" {
+			continue
+		}
+		if inserted[number] {
+			results[i].Status = model.BatchAccepted
+			// repeated numbers within the batch are reported as already uploaded
+			delete(inserted, number)
+		} else if owners[number] == userID {
+			results[i].Status = model.BatchUploaded
+		} else {
+			results[i].Status = model.BatchConflict
+		}
+	}
+
+	return results, nil
+}
+
+// List returns the user's orders, newest first. A page with zero limit means the whole list.
+// The returned cursor is empty on the last page.
+func (s *OrderService) List(ctx context.Context, userID string, page model.Page) ([]model.Order, *model.Cursor, error) {
+
+	if page.Limit < 1 {
+		list, err := s.orders.GetOrdersByUserID(ctx, userID)
+		return list, nil, err
+	}
+
+	// one extra row tells whether there is a next page
+	page.Limit++
+	list, err := s.orders.GetOrdersPageByUserID(ctx, userID, page)
+	page.Limit--
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(list) > page.Limit {
+		list = list[:page.Limit]
+		last := list[page.Limit-1]
+		return list, &model.Cursor{Time: last.UploadedAt, Merchant: last.Merchant, Key: last.Number}, nil
+	}
+
+	return list, nil, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/model"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/repository/merchants"
+	"github.com/RomanIkonnikov93/cumulative_loyalty_sys/internal/validation"
+)
+
+// validatorTTL bounds how long an update made by another instance goes
+// unnoticed; updates made through this one take effect at once.
+const validatorTTL = time.Minute
+
+type cachedValidator struct {
+	v       validation.Validator
+	expires time.Time
+}
+
+// Validators caches the validators of merchants, so uploads neither read
+// the merchant nor parse its validator spec each time. One Validators is
+// shared by every server, and MerchantService drops a merchant it updates.
+type Validators struct {
+	merchants merchants.Merchants
+	registry  *validation.Registry
+
+	mu    sync.Mutex
+	cache map[string]cachedValidator
+	// forgotten counts the calls of Forget, so a merchant read before an
+	// update isn't cached after it
+	forgotten uint64
+}
+
+// NewValidators falls back to registry, the ORDER_VALIDATORS, for merchants
+// without a validator of their own; a nil registry checks with Luhn.
+func NewValidators(m merchants.Merchants, registry *validation.Registry) *Validators {
+	return &Validators{
+		merchants: m,
+		registry:  registry,
+		cache:     make(map[string]cachedValidator),
+	}
+}
+
+// For returns the validator of merchant, or ErrUnknownMerchant when it
+// isn't registered. The empty merchant needs no registration.
+func (c *Validators) For(ctx context.Context, merchant string) (validation.Validator, error) {
+
+	if merchant == "" {
+		return c.registry.For(merchant), nil
+	}
+
+	c.mu.Lock()
+	cached, ok := c.cache[merchant]
+	forgotten := c.forgotten
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.v, nil
+	}
+
+	m, err := c.merchants.GetMerchant(ctx, merchant)
+	if errors.Is(err, model.ErrNotExist) {
+		return nil, ErrUnknownMerchant
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v := c.registry.For(merchant)
+	if m.Validator != "" {
+		v, err = validation.ParseValidator(m.Validator)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	if c.forgotten == forgotten {
+		c.cache[merchant] = cachedValidator{v: v, expires: time.Now().Add(validatorTTL)}
+	}
+	c.mu.Unlock()
+
+	return v, nil
+}
+
+// Forget drops the cached validator of merchant, after it has changed.
+func (c *Validators) Forget(merchant string) {
+
+	c.mu.Lock()
+	delete(c.cache, merchant)
+	c.forgotten++
+	c.mu.Unlock()
+}
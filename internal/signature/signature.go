@@ -0,0 +1,42 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix is put in front of the hex digest in signature headers.
+const Prefix = "sha256="
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.payload".
+func Sign(secret, timestamp string, payload []byte) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and that the unix timestamp is within tolerance of now.
+func Verify(secret, timestamp, sig string, payload []byte, tolerance time.Duration) bool {
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	age := time.Since(time.Unix(ts, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+
+	expected := Sign(secret, timestamp, payload)
+
+	return hmac.Equal([]byte(expected), []byte(strings.TrimPrefix(sig, Prefix)))
+}
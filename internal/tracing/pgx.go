@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PgxTracer turns the query log of pgx v4 into spans. pgx logs a query when
+// it is done, along with its duration, so the span is backdated to its start.
+// Only queries of a traced request are recorded; background polling is not.
+// Query arguments are left out, since they hold password hashes and such.
+type PgxTracer struct{}
+
+func (PgxTracer) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return
+	}
+	dur, ok := data["time"].(time.Duration)
+	if !ok {
+		return
+	}
+
+	end := time.Now()
+	_, span := Start(ctx, "pgx "+msg, trace.WithSpanKind(trace.SpanKindClient), trace.WithTimestamp(end.Add(-dur)),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL))
+	if sql, ok := data["sql"].(string); ok {
+		span.SetAttributes(semconv.DBStatement(sql))
+	}
+	if err, ok := data["err"].(error); ok {
+		Fail(span, err)
+	}
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,169 @@
+package validation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Registry picks the validator of a merchant. Merchants without one of
+// their own, and the empty merchant ID, get the default validator.
+type Registry struct {
+	def       Validator
+	merchants map[string]Validator
+}
+
+func NewRegistry(def Validator) *Registry {
+	return &Registry{
+		def:       def,
+		merchants: make(map[string]Validator),
+	}
+}
+
+// Register sets the validator of merchant.
+func (r *Registry) Register(merchant string, v Validator) {
+	r.merchants[merchant] = v
+}
+
+// For returns the validator of merchant. A nil Registry validates with Luhn.
+func (r *Registry) For(merchant string) Validator {
+
+	if r == nil {
+		return Luhn{}
+	}
+	if v, ok := r.merchants[merchant]; ok {
+		return v
+	}
+
+	return r.def
+}
+
+// ParseRegistry builds a registry from a spec of semicolon-separated
+// merchant=scheme entries, the scheme followed by comma-separated options:
+//
+//	*=luhn; acme=verhoeff; shop=damm,prefix=42|43,length=12-16; books=luhn-mod-n,alphabet=0123456789ABCDEF
+//
+// The merchant * sets the default, which is luhn otherwise. Schemes are
+// luhn, luhn-mod-n (alphabet defaults to Base36), verhoeff, damm and digits.
+func ParseRegistry(spec string) (*Registry, error) {
+
+	r := NewRegistry(Luhn{})
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		merchant, scheme, ok := strings.Cut(entry, "=")
+		merchant = strings.TrimSpace(merchant)
+		if !ok || merchant == "" {
+			return nil, fmt.Errorf("validator entry must look like merchant=scheme, got %q", entry)
+		}
+
+		v, err := ParseValidator(scheme)
+		if err != nil {
+			return nil, fmt.Errorf("merchant %s: %w", merchant, err)
+		}
+
+		if merchant == "*" {
+			r.def = v
+		} else {
+			r.Register(merchant, v)
+		}
+	}
+
+	return r, nil
+}
+
+// ParseValidator builds the validator of one scheme with its options, like
+// damm,prefix=42|43,length=12-16. See ParseRegistry.
+func ParseValidator(spec string) (Validator, error) {
+
+	parts := strings.Split(spec, ",")
+	scheme := strings.TrimSpace(parts[0])
+	options := make(map[string]string)
+	for _, option := range parts[1:] {
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return nil, fmt.Errorf("option must look like key=value, got %q", option)
+		}
+		options[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	var v Validator
+	switch scheme {
+	case "luhn":
+		v = Luhn{}
+	case "luhn-mod-n":
+		alphabet := Base36
+		if a, ok := options["alphabet"]; ok {
+			alphabet = a
+		}
+		if len(alphabet) < 2 || !distinct(alphabet) {
+			return nil, fmt.Errorf("alphabet must have at least two distinct characters, got %q", alphabet)
+		}
+		v = LuhnModN{Alphabet: alphabet}
+		delete(options, "alphabet")
+	case "verhoeff":
+		v = Verhoeff{}
+	case "damm":
+		v = Damm{}
+	case "digits":
+		v = DigitsOnly{}
+	default:
+		return nil, fmt.Errorf("unknown scheme %q", scheme)
+	}
+
+	rules := Rules{Scheme: v}
+	for key, value := range options {
+		switch key {
+		case "prefix":
+			rules.Prefixes = strings.Split(value, "|")
+		case "length":
+			shortest, longest, err := parseLength(value)
+			if err != nil {
+				return nil, err
+			}
+			rules.MinLength, rules.MaxLength = shortest, longest
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	if rules.Prefixes == nil && rules.MinLength == 0 && rules.MaxLength == 0 {
+		return v, nil
+	}
+
+	return rules, nil
+}
+
+// parseLength parses an exact length like 16 or a range like 12-16.
+func parseLength(s string) (int, int, error) {
+
+	from, to, isRange := strings.Cut(s, "-")
+	shortest, err := strconv.Atoi(from)
+	if err != nil || shortest < 1 {
+		return 0, 0, fmt.Errorf("length must look like 16 or 12-16, got %q", s)
+	}
+	if !isRange {
+		return shortest, shortest, nil
+	}
+	longest, err := strconv.Atoi(to)
+	if err != nil || longest < shortest {
+		return 0, 0, fmt.Errorf("length must look like 16 or 12-16, got %q", s)
+	}
+
+	return shortest, longest, nil
+}
+
+func distinct(s string) bool {
+
+	seen := make(map[byte]bool, len(s))
+	for i := 0; i < len(s); i++ {
+		if seen[s[i]] {
+			return false
+		}
+		seen[s[i]] = true
+	}
+
+	return true
+}
@@ -1,46 +1,242 @@
+// Package validation checks order numbers. The Luhn check is the default;
+// merchants may use other check digit schemes and rules, see Registry.
 package validation
 
 import (
 	"errors"
-	"strconv"
+	"strings"
 )
 
-func OrderValid(order string) (bool, error) {
+var (
+	// ErrFormat is returned for a number with characters its scheme doesn't use.
+	ErrFormat = errors.New("malformed order number")
+	// ErrCheck is matched by CheckError: the number is well formed, but not valid.
+	ErrCheck = errors.New("order number fails its check")
+)
 
-	if len(order) < 1 {
-		return false, errors.New("400")
-	}
+// CheckError tells why a well-formed number is not valid, like "fails the Luhn check".
+type CheckError struct {
+	Reason string
+}
 
-	num, err := strconv.Atoi(order)
-	if err != nil {
-		return false, errors.New("400")
-	}
+func (e *CheckError) Error() string {
+	return e.Reason
+}
 
-	res := LuhnValid(num)
+func (e *CheckError) Is(target error) bool {
+	return target == ErrCheck
+}
 
-	return res, nil
+// Validator checks an order number. It returns ErrFormat or a CheckError.
+type Validator interface {
+	Validate(number string) error
 }
 
-// LuhnValid check number is valid or not based on Luhn algorithm
-func LuhnValid(number int) bool {
-	return (number%10+checksum(number/10))%10 == 0
+// Digits reports whether s is a non-empty string of ASCII digits. Signs,
+// spaces and other digits strconv would take are not order numbers.
+func Digits(s string) bool {
+
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
 }
 
-func checksum(number int) int {
-	var luhn int
+// Luhn is the mod 10 Luhn check of bank cards, for digit strings of any length.
+type Luhn struct{}
+
+func (Luhn) Validate(number string) error {
 
-	for i := 0; number > 0; i++ {
-		cur := number % 10
+	if !Digits(number) {
+		return ErrFormat
+	}
+	if !LuhnValid(number) {
+		return &CheckError{Reason: "fails the Luhn check"}
+	}
 
-		if i%2 == 0 {
-			cur = cur * 2
+	return nil
+}
+
+// LuhnValid reports whether the digit string number passes the Luhn check.
+func LuhnValid(number string) bool {
+
+	sum := 0
+	for i := 0; i < len(number); i++ {
+		cur := int(number[len(number)-1-i] - '0')
+		if i%2 == 1 {
+			cur *= 2
 			if cur > 9 {
-				cur = cur%10 + cur/10
+				cur -= 9
 			}
 		}
+		sum += cur
+	}
+
+	return sum%10 == 0
+}
+
+// Base36 is the alphabet of LuhnModN for upper-case alphanumeric numbers.
+const Base36 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// LuhnModN generalizes Luhn to an alphabet of N characters, the
+// character's index being its value. With the ten digits it is Luhn.
+type LuhnModN struct {
+	Alphabet string
+}
+
+func (v LuhnModN) Validate(number string) error {
+
+	n := len(v.Alphabet)
+	if number == "" {
+		return ErrFormat
+	}
+
+	sum := 0
+	for i := 0; i < len(number); i++ {
+		cur := strings.IndexByte(v.Alphabet, number[len(number)-1-i])
+		if cur < 0 {
+			return ErrFormat
+		}
+		if i%2 == 1 {
+			cur *= 2
+			cur = cur/n + cur%n
+		}
+		sum += cur
+	}
+
+	if sum%n != 0 {
+		return &CheckError{Reason: "fails the Luhn mod N check"}
+	}
+
+	return nil
+}
+
+var verhoeffD = [10][10]int{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+	{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+	{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+	{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+	{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+	{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+	{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+	{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+	{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+	{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+}
+
+var verhoeffP = [8][10]int{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+	{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+	{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+	{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+	{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+	{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+	{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+	{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+}
+
+// Verhoeff is the dihedral group check, which catches every single digit
+// error and every transposition of adjacent digits.
+type Verhoeff struct{}
+
+func (Verhoeff) Validate(number string) error {
+
+	if !Digits(number) {
+		return ErrFormat
+	}
+
+	c := 0
+	for i := 0; i < len(number); i++ {
+		digit := int(number[len(number)-1-i] - '0')
+		c = verhoeffD[c][verhoeffP[i%8][digit]]
+	}
+	if c != 0 {
+		return &CheckError{Reason: "fails the Verhoeff check"}
+	}
+
+	return nil
+}
+
+var dammTable = [10][10]int{
+	{0, 3, 1, 7, 5, 9, 8, 6, 4, 2},
+	{7, 0, 9, 2, 1, 5, 4, 8, 6, 3},
+	{4, 2, 0, 6, 8, 7, 1, 3, 5, 9},
+	{1, 7, 5, 0, 9, 8, 3, 4, 2, 6},
+	{6, 1, 2, 3, 0, 4, 5, 9, 7, 8},
+	{3, 6, 7, 4, 2, 0, 9, 5, 8, 1},
+	{5, 8, 6, 9, 7, 2, 0, 1, 3, 4},
+	{8, 9, 4, 5, 3, 6, 2, 0, 1, 7},
+	{9, 4, 3, 8, 6, 1, 7, 2, 0, 5},
+	{2, 5, 8, 1, 4, 3, 6, 7, 9, 0},
+}
+
+// Damm is the quasigroup check, as strong as Verhoeff with a single table.
+type Damm struct{}
+
+func (Damm) Validate(number string) error {
+
+	if !Digits(number) {
+		return ErrFormat
+	}
+
+	interim := 0
+	for i := 0; i < len(number); i++ {
+		interim = dammTable[interim][number[i]-'0']
+	}
+	if interim != 0 {
+		return &CheckError{Reason: "fails the Damm check"}
+	}
 
-		luhn += cur
-		number = number / 10
+	return nil
+}
+
+// DigitsOnly accepts any digit string, for merchants without a check digit.
+type DigitsOnly struct{}
+
+func (DigitsOnly) Validate(number string) error {
+
+	if !Digits(number) {
+		return ErrFormat
 	}
-	return luhn % 10
+
+	return nil
+}
+
+// Rules adds prefix and length rules to a scheme. Zero values don't restrict.
+type Rules struct {
+	Scheme    Validator
+	Prefixes  []string
+	MinLength int
+	MaxLength int
+}
+
+func (v Rules) Validate(number string) error {
+
+	err := v.Scheme.Validate(number)
+	if err != nil {
+		return err
+	}
+
+	if v.MinLength > 0 && len(number) < v.MinLength {
+		return &CheckError{Reason: "is too short"}
+	}
+	if v.MaxLength > 0 && len(number) > v.MaxLength {
+		return &CheckError{Reason: "is too long"}
+	}
+	if len(v.Prefixes) > 0 {
+		for _, prefix := range v.Prefixes {
+			if strings.HasPrefix(number, prefix) {
+				return nil
+			}
+		}
+		return &CheckError{Reason: "must start with " + strings.Join(v.Prefixes, " or ")}
+	}
+
+	return nil
 }
@@ -0,0 +1,170 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidators(t *testing.T) {
+
+	hex := LuhnModN{Alphabet: "0123456789ABCDEF"}
+	tests := []struct {
+		name   string
+		v      Validator
+		number string
+		want   error
+	}{
+		// Luhn, the card numbers of the published test vectors.
+		{name: "luhn wikipedia", v: Luhn{}, number: "79927398713"},
+		{name: "luhn wikipedia wrong digit", v: Luhn{}, number: "79927398710", want: ErrCheck},
+		{name: "luhn visa test card", v: Luhn{}, number: "4111111111111111"},
+		{name: "luhn mastercard test card", v: Luhn{}, number: "5555555555554444"},
+		{name: "luhn amex test card", v: Luhn{}, number: "378282246310005"},
+		{name: "luhn transposed digits", v: Luhn{}, number: "4111111111111121", want: ErrCheck},
+		{name: "luhn zero", v: Luhn{}, number: "0"},
+		{name: "luhn 20 digits", v: Luhn{}, number: "12345678901234567894"},
+		{name: "luhn 20 digits wrong digit", v: Luhn{}, number: "12345678901234567890", want: ErrCheck},
+		{name: "luhn 40 digits", v: Luhn{}, number: "1234567890123456789012345678901234567898"},
+
+		// Luhn mod N with the ten digits is Luhn.
+		{name: "luhn mod 10", v: LuhnModN{Alphabet: "0123456789"}, number: "79927398713"},
+		{name: "luhn mod 10 wrong digit", v: LuhnModN{Alphabet: "0123456789"}, number: "79927398710", want: ErrCheck},
+		// The example of the Luhn mod N article, a=0 to f=5.
+		{name: "luhn mod 6 wikipedia", v: LuhnModN{Alphabet: "abcdef"}, number: "abcdefe"},
+		{name: "luhn mod 6 wrong character", v: LuhnModN{Alphabet: "abcdef"}, number: "abcdefa", want: ErrCheck},
+		{name: "luhn mod 16", v: hex, number: "1A2B3F"},
+		{name: "luhn mod 16 lower case", v: hex, number: "1a2b3f", want: ErrFormat},
+		{name: "luhn mod 36 24 characters", v: LuhnModN{Alphabet: Base36}, number: "ABCDEFGHIJKLMNOPQRSTUVWD"},
+		{name: "luhn mod n empty", v: hex, number: "", want: ErrFormat},
+
+		// Verhoeff, the examples of the Wikipedia article.
+		{name: "verhoeff wikipedia", v: Verhoeff{}, number: "2363"},
+		{name: "verhoeff wikipedia wrong digit", v: Verhoeff{}, number: "2364", want: ErrCheck},
+		{name: "verhoeff 12345", v: Verhoeff{}, number: "123451"},
+		{name: "verhoeff transposed digits", v: Verhoeff{}, number: "213451", want: ErrCheck},
+		{name: "verhoeff 20 digits", v: Verhoeff{}, number: "12345678901234567895"},
+
+		// Damm, the example of the Wikipedia article.
+		{name: "damm wikipedia", v: Damm{}, number: "5724"},
+		{name: "damm wikipedia wrong digit", v: Damm{}, number: "5723", want: ErrCheck},
+		{name: "damm transposed digits", v: Damm{}, number: "7524", want: ErrCheck},
+		{name: "damm 20 digits", v: Damm{}, number: "12345678901234567891"},
+
+		{name: "digits only", v: DigitsOnly{}, number: "12345678901234567890123"},
+		{name: "digits only letters", v: DigitsOnly{}, number: "12a", want: ErrFormat},
+
+		// Strings strconv would take, or overflow on, are not order numbers.
+		{name: "plus sign", v: Luhn{}, number: "+79927398713", want: ErrFormat},
+		{name: "minus sign", v: Luhn{}, number: "-79927398713", want: ErrFormat},
+		{name: "leading space", v: Luhn{}, number: " 79927398713", want: ErrFormat},
+		{name: "trailing newline", v: Luhn{}, number: "79927398713\n", want: ErrFormat},
+		{name: "underscores", v: Luhn{}, number: "7_992_739_871_3", want: ErrFormat},
+		{name: "hex prefix", v: Luhn{}, number: "0x1F", want: ErrFormat},
+		{name: "exponent", v: Luhn{}, number: "1e10", want: ErrFormat},
+		{name: "arabic-indic digits", v: Luhn{}, number: "٧٩٩٢٧٣٩٨٧١٣", want: ErrFormat},
+		{name: "empty", v: Luhn{}, number: "", want: ErrFormat},
+		{name: "past uint64", v: Luhn{}, number: "99999999999999999999992"},
+		{name: "verhoeff sign", v: Verhoeff{}, number: "-2363", want: ErrFormat},
+		{name: "damm sign", v: Damm{}, number: "+5724", want: ErrFormat},
+
+		{name: "rules prefix", v: Rules{Scheme: Luhn{}, Prefixes: []string{"4", "5"}}, number: "4111111111111111"},
+		{name: "rules wrong prefix", v: Rules{Scheme: Luhn{}, Prefixes: []string{"5"}}, number: "4111111111111111", want: ErrCheck},
+		{name: "rules too short", v: Rules{Scheme: Luhn{}, MinLength: 12}, number: "79927398713", want: ErrCheck},
+		{name: "rules too long", v: Rules{Scheme: Luhn{}, MaxLength: 10}, number: "79927398713", want: ErrCheck},
+		{name: "rules scheme first", v: Rules{Scheme: Luhn{}, MaxLength: 10}, number: "-1", want: ErrFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.v.Validate(tt.number)
+			if tt.want == nil && err != nil {
+				t.Fatalf("Validate(%q) = %v, want nil", tt.number, err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Validate(%q) = %v, want %v", tt.number, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRegistry(t *testing.T) {
+
+	r, err := ParseRegistry("*=damm; acme=verhoeff; shop=luhn,prefix=42|43,length=12-16; books=luhn-mod-n,alphabet=0123456789ABCDEF")
+	if err != nil {
+		t.Fatalf("ParseRegistry: %v", err)
+	}
+
+	tests := []struct {
+		merchant string
+		number   string
+		want     error
+	}{
+		{merchant: "", number: "5724"},
+		{merchant: "unknown", number: "5724"},
+		{merchant: "unknown", number: "79927398713", want: ErrCheck},
+		{merchant: "acme", number: "2363"},
+		{merchant: "acme", number: "5724", want: ErrCheck},
+		{merchant: "shop", number: "420000000000"},
+		{merchant: "shop", number: "440000000008", want: ErrCheck},
+		{merchant: "shop", number: "4200000000", want: ErrCheck},
+		{merchant: "books", number: "1A2B3F"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.merchant+"/"+tt.number, func(t *testing.T) {
+			err := r.For(tt.merchant).Validate(tt.number)
+			if tt.want == nil && err != nil {
+				t.Fatalf("Validate(%q) = %v, want nil", tt.number, err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Validate(%q) = %v, want %v", tt.number, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRegistryDefaults(t *testing.T) {
+
+	for _, spec := range []string{"", " ; ;", "acme=damm"} {
+		r, err := ParseRegistry(spec)
+		if err != nil {
+			t.Fatalf("ParseRegistry(%q): %v", spec, err)
+		}
+		if err := r.For("").Validate("79927398713"); err != nil {
+			t.Errorf("ParseRegistry(%q) default: %v, want Luhn", spec, err)
+		}
+	}
+
+	var r *Registry
+	if err := r.For("acme").Validate("79927398713"); err != nil {
+		t.Errorf("nil Registry: %v, want Luhn", err)
+	}
+}
+
+func TestParseRegistryMalformed(t *testing.T) {
+
+	for _, spec := range []string{
+		"acme",
+		"=luhn",
+		" =luhn",
+		"acme=",
+		"acme=mod97",
+		"acme=LUHN",
+		"acme=luhn,prefix",
+		"acme=luhn,colour=red",
+		"acme=luhn,length=",
+		"acme=luhn,length=0",
+		"acme=luhn,length=-5",
+		"acme=luhn,length=16-12",
+		"acme=luhn,length=12-",
+		"acme=luhn,length=twelve",
+		"acme=luhn,length=99999999999999999999",
+		"acme=luhn-mod-n,alphabet=",
+		"acme=luhn-mod-n,alphabet=A",
+		"acme=luhn-mod-n,alphabet=ABCA",
+		"acme=verhoeff,alphabet=0123456789",
+		"*=luhn; shop=damm,prefix=42|43,length=x",
+	} {
+		if _, err := ParseRegistry(spec); err == nil {
+			t.Errorf("ParseRegistry(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+// Fields of a request are added to every line logged with its context,
+// including lines logged by the middlewares that wrap the handler.
+type fields struct {
+	mu   sync.Mutex
+	data logrus.Fields
+}
+
+type fieldsKey struct{}
+
+// WithFields prepares ctx to carry the fields set by AddField.
+func WithFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fields{data: logrus.Fields{}})
+}
+
+// AddField sets a field of ctx and of every context it was derived from
+// since WithFields. Without WithFields it does nothing.
+func AddField(ctx context.Context, key string, value any) {
+
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.data[key] = value
+}
+
+// Ctx returns a logger that adds the fields of ctx to its lines.
+func (l Logger) Ctx(ctx context.Context) Logger {
+	return Logger{l.WithContext(ctx)}
+}
+
+// contextHook adds the fields of the entry context and its chi route.
+type contextHook struct{}
+
+func (contextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (contextHook) Fire(entry *logrus.Entry) error {
+
+	if entry.Context == nil {
+		return nil
+	}
+
+	if f, ok := entry.Context.Value(fieldsKey{}).(*fields); ok {
+		f.mu.Lock()
+		for k, v := range f.data {
+			entry.Data[k] = v
+		}
+		f.mu.Unlock()
+	}
+
+	if rctx := chi.RouteContext(entry.Context); rctx != nil && rctx.RoutePattern() != "" {
+		entry.Data["route"] = rctx.RoutePattern()
+	}
+
+	return nil
+}
@@ -5,78 +5,111 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
 
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-type writerHook struct {
-	Writer    []io.Writer
-	LogLevels []logrus.Level
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configure the logger of the service. An empty File logs to stdout only.
+type Options struct {
+	Format     string
+	Level      string
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
 }
 
-func (hook *writerHook) Fire(entry *logrus.Entry) error {
+type Logger struct {
+	*logrus.Entry
+}
 
-	line, err := entry.String()
-	if err != nil {
-		return err
-	}
+// base is the one logrus instance behind every Logger, so Setup applies to
+// loggers handed out before it was called.
+var base = newBase()
 
-	for _, w := range hook.Writer {
-		w.Write([]byte(line))
-	}
+func newBase() *logrus.Logger {
 
-	return err
-}
+	l := logrus.New()
+	l.SetReportCaller(true)
+	l.Formatter = textFormatter()
+	l.SetOutput(os.Stdout)
+	l.SetLevel(logrus.InfoLevel)
+	l.AddHook(contextHook{})
 
-func (hook *writerHook) Levels() []logrus.Level {
-	return hook.LogLevels
+	return l
 }
 
-type Logger struct {
-	*logrus.Entry
+func caller(frame *runtime.Frame) (function string, file string) {
+	filename := path.Base(frame.File)
+	return fmt.Sprintf("%s()", frame.Function), fmt.Sprintf("%s:%d", filename, frame.Line)
 }
 
-func GetLogger() *Logger {
-	e := Log()
-	return &Logger{
-		e,
+func textFormatter() logrus.Formatter {
+	return &logrus.TextFormatter{
+		CallerPrettyfier: caller,
+		DisableColors:    false,
+		FullTimestamp:    true,
 	}
 }
 
-func Log() *logrus.Entry {
+// Setup configures the logger. It is meant to be called once at start.
+func Setup(opts Options) error {
 
-	l := logrus.New()
-	l.SetReportCaller(true)
-	l.Formatter = &logrus.TextFormatter{
-		CallerPrettyfier: func(frame *runtime.Frame) (function string, file string) {
-			filename := path.Base(frame.File)
-			return fmt.Sprintf("%s()", frame.Function), fmt.Sprintf("%s:%d", filename, frame.Line)
-		},
-		DisableColors: false,
-		FullTimestamp: true,
+	level := logrus.InfoLevel
+	if opts.Level != "" {
+		var err error
+		level, err = logrus.ParseLevel(opts.Level)
+		if err != nil {
+			return err
+		}
 	}
 
-	err := os.MkdirAll("logs", 0744)
-	if err != nil {
-		panic(err)
+	var formatter logrus.Formatter
+	switch opts.Format {
+	case FormatText, "":
+		formatter = textFormatter()
+	case FormatJSON:
+		formatter = &logrus.JSONFormatter{CallerPrettyfier: caller}
+	default:
+		return fmt.Errorf("unknown log format: %s", opts.Format)
 	}
 
-	allFile, err := os.OpenFile("logs/all.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0744)
-	if err != nil {
-		panic(err)
+	var out io.Writer = os.Stdout
+	if opts.File != "" {
+		err := os.MkdirAll(filepath.Dir(opts.File), 0744)
+		if err != nil {
+			return err
+		}
+		out = io.MultiWriter(os.Stdout, &lumberjack.Logger{
+			Filename:   opts.File,
+			MaxSize:    opts.MaxSizeMB,
+			MaxBackups: opts.MaxBackups,
+			MaxAge:     opts.MaxAgeDays,
+		})
 	}
 
-	l.SetOutput(io.Discard)
-
-	l.AddHook(&writerHook{
-		Writer:    []io.Writer{allFile, os.Stdout},
-		LogLevels: logrus.AllLevels,
-	})
+	base.SetFormatter(formatter)
+	base.SetOutput(out)
+	base.SetLevel(level)
 
-	l.SetLevel(logrus.TraceLevel)
+	return nil
+}
 
-	e := logrus.NewEntry(l)
+func GetLogger() *Logger {
+	e := Log()
+	return &Logger{
+		e,
+	}
+}
 
-	return e
+func Log() *logrus.Entry {
+	return logrus.NewEntry(base)
 }